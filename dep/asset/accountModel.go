@@ -51,7 +51,9 @@ func issueAccountAsset(db StateDB, accountAddr common.Address, nonce uint64, des
 
 	save(db, uint64(AccountModel), assetAddr, assetTypeKey)
 	//issue balance to owner
-	setAccountList(AccountModel, db, info.Owner, assetAddr)
+	if err := setAccountList(AccountModel, db, info.Owner, assetAddr); err != nil {
+		return common.Address{}, err
+	}
 	key := info.Owner.String() + assetAddr.String()
 	save(db, info.Total, info.Owner, key)
 	return assetAddr, nil
@@ -163,7 +165,9 @@ func addAccountlBalance(db StateDB, targetAddr common.Address, assetAddr common.
 		}
 	} else {
 		balance = big.NewInt(0)
-		setAccountList(AccountModel, db, targetAddr, assetAddr)
+		if err := setAccountList(AccountModel, db, targetAddr, assetAddr); err != nil {
+			return err
+		}
 	}
 	balance = new(big.Int).Add(balance, value)
 	save(db, balance, targetAddr, key)
@@ -78,20 +78,31 @@ func InitZip(db StateDB, total *big.Int, decimals uint64) error {
 	return nil
 }
 
+// atomic runs fn and rolls back every ledger write it made if fn fails, so
+// a failed operation never leaves a partially updated asset behind.
+func (a *Asset) atomic(fn func() error) error {
+	snapshot := a.db.Snapshot()
+	if err := fn(); err != nil {
+		a.db.RevertToSnapshot(snapshot)
+		return err
+	}
+	return nil
+}
+
 // IssueAsset create asset
 func (a *Asset) IssueAsset(baseType int, accountAddr common.Address, desc string) (common.Address, error) {
 	var addr common.Address
-	var err error
-	switch baseType {
-	case AccountModel:
-		addr, err = issueAccountAsset(a.db, accountAddr, a.GetNonce(accountAddr), desc)
-		if err != nil {
-			return addr, err
+	err := a.atomic(func() error {
+		var err error
+		switch baseType {
+		case AccountModel:
+			addr, err = issueAccountAsset(a.db, accountAddr, a.GetNonce(accountAddr), desc)
+		case UtxoModel:
+			fmt.Println("Utxo")
 		}
-	case UtxoModel:
-		fmt.Println("Utxo")
-	}
-	return addr, nil
+		return err
+	})
+	return addr, err
 }
 
 // SetNewOwner .
@@ -101,16 +112,37 @@ func (a *Asset) SetNewOwner(oldOwner common.Address, assetAddr common.Address, n
 		return false, err
 	}
 	var ok bool
+	err = a.atomic(func() error {
+		var err error
+		switch baseType {
+		case AccountModel:
+			ok, err = setAccountNewOwner(a.db, oldOwner, assetAddr, newOwner)
+		case UtxoModel:
+			fmt.Println("Utxo")
+		}
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// GetAssetInfo returns the metadata of the asset issued at assetAddr.
+func (a *Asset) GetAssetInfo(assetAddr common.Address) (*AccountAssetInfo, error) {
+	baseType, err := a.getAssetType(assetAddr)
+	if err != nil {
+		return nil, err
+	}
 	switch baseType {
 	case AccountModel:
-		ok, err = setAccountNewOwner(a.db, oldOwner, assetAddr, newOwner)
+		info, err := getAccountAssetInfo(a.db, assetAddr)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-	case UtxoModel:
-		fmt.Println("Utxo")
+		return &info, nil
 	}
-	return ok, nil
+	return nil, fmt.Errorf("unsupported asset type %d", baseType)
 }
 
 // IncreaseAsset issue asset
@@ -119,17 +151,16 @@ func (a *Asset) IncreaseAsset(ownerAddr common.Address, assetAddr common.Address
 	if err != nil {
 		return err
 	}
-	switch baseType {
-	case AccountModel:
-		v := value.(*big.Int)
-		err := increaseAccountAsset(a.db, ownerAddr, assetAddr, v)
-		if err != nil {
-			return err
+	return a.atomic(func() error {
+		switch baseType {
+		case AccountModel:
+			v := value.(*big.Int)
+			return increaseAccountAsset(a.db, ownerAddr, assetAddr, v)
+		case UtxoModel:
+			fmt.Println("Utxo")
 		}
-	case UtxoModel:
-		fmt.Println("Utxo")
-	}
-	return nil
+		return nil
+	})
 }
 
 //UserAsset user asset info
@@ -181,7 +212,8 @@ func (a *Asset) GetUserAssets(address common.Address) ([]UserAsset, error) {
 		return assets, nil
 	}
 
-	return nil, fmt.Errorf("not Account list info")
+	// an account without a list holds no assets
+	return nil, nil
 }
 
 //Account .
@@ -206,17 +238,16 @@ func (a *Asset) SubBalance(targetAddr common.Address, assetAddr common.Address,
 	if err != nil {
 		return err
 	}
-	switch baseType {
-	case AccountModel:
-		v := value.(*big.Int)
-		err := subAccountBalance(a.db, targetAddr, assetAddr, v)
-		if err != nil {
-			return err
+	return a.atomic(func() error {
+		switch baseType {
+		case AccountModel:
+			v := value.(*big.Int)
+			return subAccountBalance(a.db, targetAddr, assetAddr, v)
+		case UtxoModel:
+			fmt.Println("Utxo")
 		}
-	case UtxoModel:
-		fmt.Println("Utxo")
-	}
-	return nil
+		return nil
+	})
 }
 
 // AddBalance add account balance
@@ -225,17 +256,16 @@ func (a *Asset) AddBalance(targetAddr common.Address, assetAddr common.Address,
 	if err != nil {
 		return err
 	}
-	switch baseType {
-	case AccountModel:
-		v := value.(*big.Int)
-		err := addAccountlBalance(a.db, targetAddr, assetAddr, v)
-		if err != nil {
-			return err
+	return a.atomic(func() error {
+		switch baseType {
+		case AccountModel:
+			v := value.(*big.Int)
+			return addAccountlBalance(a.db, targetAddr, assetAddr, v)
+		case UtxoModel:
+			fmt.Println("Utxo")
 		}
-	case UtxoModel:
-		fmt.Println("Utxo")
-	}
-	return nil
+		return nil
+	})
 }
 
 // EnoughBalance .
@@ -258,14 +288,18 @@ func (a *Asset) EnoughBalance(targetAddr common.Address, assetAddr common.Addres
 	return enough, nil
 }
 
-// GetBalance get account balance
+// GetBalance get account balance, unknown assets and accounts without a
+// balance entry hold zero
 func (a *Asset) GetBalance(targetAddr common.Address, assetAddr common.Address) interface{} {
 	baseType, err := a.getAssetType(assetAddr)
 	if err != nil {
-		panic("GetBalance error")
+		return new(big.Int)
 	}
 	switch baseType {
 	case AccountModel:
+		if len(a.db.GetAccount(targetAddr, targetAddr.String()+assetAddr.String())) == 0 {
+			return new(big.Int)
+		}
 		balance, err := getAccountBalance(a.db, targetAddr, assetAddr)
 		if err != nil {
 			panic("GetBalance error")
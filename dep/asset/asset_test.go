@@ -0,0 +1,141 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package asset
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/dep/statedb"
+)
+
+func issueTestAsset(t *testing.T, a *Asset, owner common.Address, total int64) common.Address {
+	desc, _ := json.Marshal(&AccountAssetInfo{
+		Name:     "test",
+		Symbol:   "TST",
+		Total:    big.NewInt(total),
+		Decimals: 8,
+		Owner:    owner,
+	})
+	assetAddr, err := a.IssueAsset(AccountModel, owner, string(desc))
+	if err != nil {
+		t.Fatalf("failed to issue asset: %v", err)
+	}
+	return assetAddr
+}
+
+func TestRevertLedgerWrites(t *testing.T) {
+	state, _ := statedb.New(common.Hash{}, memdb.NewMemDatabase())
+	a := NewAsset(state)
+
+	owner, receiver := common.Address{1, 1}, common.Address{2, 2}
+	assetAddr := issueTestAsset(t, a, owner, 1000)
+
+	snapshot := state.Snapshot()
+	if err := a.SubBalance(owner, assetAddr, big.NewInt(400)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddBalance(receiver, assetAddr, big.NewInt(400)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.IncreaseAsset(owner, assetAddr, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	a.SetNonce(owner, 7)
+	state.RevertToSnapshot(snapshot)
+
+	if balance := a.GetBalance(owner, assetAddr).(*big.Int); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("owner balance mismatch: have %v, want 1000", balance)
+	}
+	if ok, err := a.EnoughBalance(receiver, assetAddr, big.NewInt(1)); ok || err == nil {
+		t.Errorf("receiver balance survived revert")
+	}
+	if nonce := a.GetNonce(owner); nonce == 7 {
+		t.Errorf("nonce survived revert")
+	}
+	info, _ := getAccountAssetInfo(state, assetAddr)
+	if info.Total.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("asset total mismatch: have %v, want 1000", info.Total)
+	}
+}
+
+func TestFailedOperationLeavesNoWrites(t *testing.T) {
+	state, _ := statedb.New(common.Hash{}, memdb.NewMemDatabase())
+	a := NewAsset(state)
+
+	owner, other := common.Address{1, 1}, common.Address{2, 2}
+	assetAddr := issueTestAsset(t, a, owner, 1000)
+
+	// A new owner without a balance entry makes IncreaseAsset fail after the
+	// asset total was already rewritten, the failure must roll that back too.
+	if ok, err := a.SetNewOwner(owner, assetAddr, other); !ok || err != nil {
+		t.Fatalf("failed to change owner: %v", err)
+	}
+	if err := a.IncreaseAsset(other, assetAddr, big.NewInt(1)); err == nil {
+		t.Fatal("expected increase without owner balance to fail")
+	}
+	info, _ := getAccountAssetInfo(state, assetAddr)
+	if info.Total.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("asset total mismatch: have %v, want 1000", info.Total)
+	}
+	if err := a.SubBalance(owner, assetAddr, big.NewInt(2000)); err == nil {
+		t.Fatal("expected overdraft to fail")
+	}
+	if balance := a.GetBalance(owner, assetAddr).(*big.Int); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("owner balance mismatch: have %v, want 1000", balance)
+	}
+}
+
+func TestDump(t *testing.T) {
+	state, _ := statedb.New(common.Hash{}, memdb.NewMemDatabase())
+	a := NewAsset(state)
+
+	owner, contract := common.Address{1, 1}, common.Address{3, 3}
+	assetAddr := issueTestAsset(t, a, owner, 1000)
+	a.SetNonce(owner, 5)
+	state.SetCode(contract, []byte{0x60, 0x01})
+	state.SetState(contract, common.Hash{}, common.BytesToHash([]byte{0x2a}))
+	state.IntermediateRoot(true)
+
+	dump, err := RawDump(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerKey, contractKey, assetKey := common.Bytes2Hex(owner[:]), common.Bytes2Hex(contract[:]), common.Bytes2Hex(assetAddr[:])
+	if account := dump.Accounts[ownerKey]; account.Nonce != 5 || account.Balances[assetKey] != "1000" {
+		t.Errorf("owner mismatch: have nonce %d balances %v", account.Nonce, account.Balances)
+	}
+	account := dump.Accounts[contractKey]
+	if account.Code != "6001" {
+		t.Errorf("code mismatch: have %q, want 6001", account.Code)
+	}
+	if value := account.Storage[common.Bytes2Hex(common.Hash{}.Bytes())]; value != "2a" {
+		t.Errorf("storage mismatch: have %q, want 2a", value)
+	}
+	if info, ok := dump.Assets[assetKey]; !ok || info.Symbol != "TST" || info.Total != "1000" || info.Owner != ownerKey {
+		t.Errorf("asset metadata mismatch: have %+v", info)
+	}
+
+	first, _ := Dump(state)
+	second, _ := Dump(state)
+	if string(first) != string(second) {
+		t.Errorf("dump is not deterministic")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package asset
+
+import (
+	"encoding/json"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/statedb"
+)
+
+// RawDump returns the dump of db completed with the ledger records: the
+// nonce and the asset balances of every account and the metadata of every
+// issued asset.
+func RawDump(db *statedb.StateDB) (statedb.Dump, error) {
+	dump := db.RawDump()
+	ledger := NewAsset(db)
+	for key, account := range dump.Accounts {
+		addr := common.HexToAddress(key)
+		// The record under the account's own address holds the metadata
+		// of an issued asset, or the nonce of any other account.
+		if info, err := ledger.GetAssetInfo(addr); err == nil {
+			dump.Assets[key] = statedb.DumpAsset{
+				Name:     info.Name,
+				Symbol:   info.Symbol,
+				Total:    info.Total.String(),
+				Decimals: info.Decimals,
+				Owner:    common.Bytes2Hex(info.Owner[:]),
+			}
+		} else if len(db.GetAccount(addr, addr.String())) > 0 {
+			account.Nonce = ledger.GetNonce(addr)
+		}
+		holdings, err := ledger.GetUserAssets(addr)
+		if err != nil {
+			return dump, err
+		}
+		for _, holding := range holdings {
+			account.Balances[common.Bytes2Hex(holding.AssetAddr[:])] = holding.Balance.String()
+		}
+		dump.Accounts[key] = account
+	}
+	return dump, nil
+}
+
+// Dump returns the RawDump of db as indented JSON. The keys of every object
+// are sorted, so equal states produce equal dumps.
+func Dump(db *statedb.StateDB) ([]byte, error) {
+	dump, err := RawDump(db)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(dump, "", "    ")
+}
@@ -9,4 +9,7 @@ type StateDB interface {
 	GetAccount(addr common.Address, key string) []byte
 	SetAccount(addr common.Address, key string, value []byte)
 	GetRefund() uint64
+
+	Snapshot() int
+	RevertToSnapshot(int)
 }
\ No newline at end of file
@@ -0,0 +1,558 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package filedb implements a durable key-value store on top of a single
+// append-only log file.
+//
+// Every batch is written as one checksummed record, so a batch is either
+// fully applied or, if the process dies while writing it, dropped when the
+// database is reopened. The positions of the live values are kept in an
+// in-memory index and the log is rewritten without the stale records once
+// they take up most of the file.
+package filedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/vm-project/dep/memdb"
+)
+
+const (
+	// logName is the name of the log file inside the database directory.
+	logName = "data.log"
+
+	// headerSize is the size of a record header: the checksum and the
+	// length of the payload.
+	headerSize = 8
+
+	// compactMinSize is the log size below which no automatic compaction
+	// is done.
+	compactMinSize = 4 * 1024 * 1024
+
+	opPut    byte = 1
+	opDelete byte = 2
+)
+
+var (
+	// ErrNotFound is returned by Get if the key is not in the database.
+	ErrNotFound = errors.New("not found")
+
+	// ErrClosed is returned by the operations on a closed database.
+	ErrClosed = errors.New("database closed")
+
+	errCorruptRecord = errors.New("corrupt record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// entry locates a live value inside the log.
+type entry struct {
+	offset int64
+	size   int
+}
+
+// Database is a key-value store persisted in a directory. All methods are
+// safe for concurrent use, the directory must not be opened by more than
+// one Database at a time.
+type Database struct {
+	path string
+	file *os.File
+	size int64 // end of the last complete record
+
+	index map[string]entry
+	live  int64 // bytes of the records still referenced by the index
+
+	lock sync.RWMutex
+}
+
+var _ memdb.Database = (*Database)(nil)
+
+// New opens the database in dir, creating it if it does not exist. A record
+// left incomplete by a crash is discarded.
+func New(dir string) (*Database, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	db := &Database{path: filepath.Join(dir, logName)}
+	if err := db.open(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// open opens the log file and rebuilds the index from it, truncating the
+// log after the last valid record.
+func (db *Database) open() error {
+	file, err := os.OpenFile(db.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	db.index = make(map[string]entry)
+	db.live = 0
+
+	var (
+		offset int64
+		header [headerSize]byte
+	)
+	for {
+		if _, err := file.ReadAt(header[:], offset); err != nil {
+			break
+		}
+		// The length is not covered by the checksum, a corrupt one must
+		// not make us allocate more than the file holds.
+		length := int64(binary.BigEndian.Uint32(header[4:]))
+		if length > info.Size()-offset-headerSize {
+			break
+		}
+		payload := make([]byte, length)
+		if _, err := file.ReadAt(payload, offset+headerSize); err != nil {
+			break
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[:4]) {
+			break
+		}
+		if err := db.replay(payload, offset+headerSize); err != nil {
+			break
+		}
+		offset += headerSize + length
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return err
+	}
+	db.file, db.size = file, offset
+	return nil
+}
+
+// replay applies the operations of a record payload, found at offset in the
+// log, to the index.
+func (db *Database) replay(payload []byte, offset int64) error {
+	ops, err := decodeOps(payload)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		db.drop(op.key)
+		if op.kind == opPut {
+			db.index[string(op.key)] = entry{offset: offset + int64(op.valuePos), size: len(op.value)}
+			db.live += op.size()
+		}
+	}
+	return nil
+}
+
+// drop removes key from the index, accounting its record as stale.
+func (db *Database) drop(key []byte) {
+	if old, ok := db.index[string(key)]; ok {
+		db.live -= putSize(len(key), old.size)
+		delete(db.index, string(key))
+	}
+}
+
+// Put sets the value of key.
+func (db *Database) Put(key []byte, value []byte) error {
+	return db.write([]op{{kind: opPut, key: key, value: value}})
+}
+
+// Has reports whether key is in the database.
+func (db *Database) Has(key []byte) (bool, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.file == nil {
+		return false, ErrClosed
+	}
+	_, ok := db.index[string(key)]
+	return ok, nil
+}
+
+// Get returns the value of key, or ErrNotFound if it is missing.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if db.file == nil {
+		return nil, ErrClosed
+	}
+	e, ok := db.index[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return db.read(e)
+}
+
+func (db *Database) read(e entry) ([]byte, error) {
+	value := make([]byte, e.size)
+	if _, err := db.file.ReadAt(value, e.offset); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Delete removes key from the database.
+func (db *Database) Delete(key []byte) error {
+	return db.write([]op{{kind: opDelete, key: key}})
+}
+
+// Close closes the log file, the database can't be used afterwards.
+func (db *Database) Close() {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.file != nil {
+		db.file.Close()
+		db.file = nil
+	}
+}
+
+// NewBatch creates a batch whose writes are applied atomically by Write.
+func (db *Database) NewBatch() memdb.Batch {
+	return &Batch{db: db}
+}
+
+// write appends ops as a single record, syncs it to disk and updates the
+// index. The log is compacted once the stale records dominate it.
+func (db *Database) write(ops []op) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.file == nil {
+		return ErrClosed
+	}
+	payload := encodeOps(ops)
+	record := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(record[:4], crc32.Checksum(payload, crcTable))
+	binary.BigEndian.PutUint32(record[4:headerSize], uint32(len(payload)))
+	copy(record[headerSize:], payload)
+
+	// A record that didn't make it to disk is dropped, so that it isn't
+	// replayed on reopen and later writes don't follow garbage.
+	if _, err := db.file.WriteAt(record, db.size); err != nil {
+		db.file.Truncate(db.size)
+		return err
+	}
+	if err := db.file.Sync(); err != nil {
+		db.file.Truncate(db.size)
+		return err
+	}
+	if err := db.replay(payload, db.size+headerSize); err != nil {
+		db.file.Truncate(db.size)
+		return err
+	}
+	db.size += int64(len(record))
+
+	// The record is committed, a failed compaction keeps the old log and
+	// is retried by the next write, unless the log couldn't be reopened.
+	if db.size > compactMinSize && db.size > 2*db.live {
+		db.compact()
+	}
+	return nil
+}
+
+// Compact rewrites the log with only the live values, reclaiming the space
+// of overwritten and deleted keys.
+func (db *Database) Compact() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.file == nil {
+		return ErrClosed
+	}
+	return db.compact()
+}
+
+func (db *Database) compact() error {
+	tmpPath := db.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	var (
+		ops  []op
+		size int64
+	)
+	flush := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		payload := encodeOps(ops)
+		var header [headerSize]byte
+		binary.BigEndian.PutUint32(header[:4], crc32.Checksum(payload, crcTable))
+		binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+		if _, err := tmp.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := tmp.Write(payload); err != nil {
+			return err
+		}
+		ops, size = ops[:0], 0
+		return nil
+	}
+	for _, key := range db.sortedKeys(nil) {
+		value, err := db.read(db.index[key])
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		ops = append(ops, op{kind: opPut, key: []byte(key), value: value})
+		if size += putSize(len(key), len(value)); size >= memdb.IdealBatchSize {
+			if err := flush(); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	// Swap the logs, a crash before the rename keeps the old one intact.
+	// If the log can't be reopened the database is left closed.
+	db.file.Close()
+	db.file = nil
+	if err := os.Rename(tmpPath, db.path); err != nil {
+		if reopenErr := db.open(); reopenErr != nil {
+			return reopenErr
+		}
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(db.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return db.open()
+}
+
+// sortedKeys returns the keys in the index starting with prefix in
+// ascending order.
+func (db *Database) sortedKeys(prefix []byte) []string {
+	keys := make([]string, 0, len(db.index))
+	for key := range db.index {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of keys in the database.
+func (db *Database) Len() int {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return len(db.index)
+}
+
+// op is a single write of a record.
+type op struct {
+	kind     byte
+	key      []byte
+	value    []byte
+	valuePos int // position of the value in the decoded payload
+}
+
+// size returns the encoded size of the op.
+func (o op) size() int64 {
+	if o.kind == opDelete {
+		return int64(1 + uvarintSize(uint64(len(o.key))) + len(o.key))
+	}
+	return putSize(len(o.key), len(o.value))
+}
+
+func putSize(keyLen, valueLen int) int64 {
+	return int64(1 + uvarintSize(uint64(keyLen)) + keyLen + uvarintSize(uint64(valueLen)) + valueLen)
+}
+
+func uvarintSize(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+// encodeOps encodes ops as a record payload. A put is encoded as its kind
+// followed by the length prefixed key and value, a delete has no value.
+func encodeOps(ops []op) []byte {
+	var (
+		buf []byte
+		tmp [binary.MaxVarintLen64]byte
+	)
+	for _, o := range ops {
+		buf = append(buf, o.kind)
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(o.key)))]...)
+		buf = append(buf, o.key...)
+		if o.kind == opPut {
+			buf = append(buf, tmp[:binary.PutUvarint(tmp[:], uint64(len(o.value)))]...)
+			buf = append(buf, o.value...)
+		}
+	}
+	return buf
+}
+
+// decodeOps decodes a record payload, the keys and values alias it.
+func decodeOps(payload []byte) ([]op, error) {
+	var (
+		ops []op
+		pos int
+	)
+	next := func() ([]byte, error) {
+		n, size := binary.Uvarint(payload[pos:])
+		if size <= 0 || uint64(len(payload)-pos-size) < n {
+			return nil, errCorruptRecord
+		}
+		pos += size
+		b := payload[pos : pos+int(n)]
+		pos += int(n)
+		return b, nil
+	}
+	for pos < len(payload) {
+		o := op{kind: payload[pos]}
+		pos++
+		if o.kind != opPut && o.kind != opDelete {
+			return nil, errCorruptRecord
+		}
+		var err error
+		if o.key, err = next(); err != nil {
+			return nil, err
+		}
+		if o.kind == opPut {
+			if o.value, err = next(); err != nil {
+				return nil, err
+			}
+			o.valuePos = pos - len(o.value)
+		}
+		ops = append(ops, o)
+	}
+	return ops, nil
+}
+
+// Batch is a write-only set of changes applied atomically to the database
+// by Write. Batch cannot be used concurrently.
+type Batch struct {
+	db   *Database
+	ops  []op
+	size int
+}
+
+// Put adds a write of key to the batch.
+func (b *Batch) Put(key, value []byte) error {
+	b.ops = append(b.ops, op{kind: opPut, key: memdb.CopyBytes(key), value: memdb.CopyBytes(value)})
+	b.size += len(value)
+	return nil
+}
+
+// Delete adds a removal of key to the batch.
+func (b *Batch) Delete(key []byte) error {
+	b.ops = append(b.ops, op{kind: opDelete, key: memdb.CopyBytes(key)})
+	b.size++
+	return nil
+}
+
+// ValueSize returns the amount of data in the batch.
+func (b *Batch) ValueSize() int {
+	return b.size
+}
+
+// Write applies the batch to the database as a single record.
+func (b *Batch) Write() error {
+	if len(b.ops) == 0 {
+		return nil
+	}
+	return b.db.write(b.ops)
+}
+
+// Reset clears the batch for reuse.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+	b.size = 0
+}
+
+// Iterator walks over the keys present in the database when it was created,
+// in ascending order. Keys deleted since are skipped and values are read when
+// the iterator reaches them.
+type Iterator struct {
+	db    *Database
+	keys  []string
+	pos   int
+	value []byte
+	err   error
+}
+
+// NewIteratorWithPrefix returns an iterator over the keys starting with
+// prefix.
+func (db *Database) NewIteratorWithPrefix(prefix []byte) *Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return &Iterator{db: db, keys: db.sortedKeys(prefix), pos: -1}
+}
+
+// Next moves the iterator to the next key, it returns false when the keys
+// are exhausted or the value could not be read.
+func (it *Iterator) Next() bool {
+	for it.err == nil && it.pos+1 < len(it.keys) {
+		it.pos++
+		it.db.lock.RLock()
+		e, ok := it.db.index[it.keys[it.pos]]
+		if ok {
+			if it.db.file == nil {
+				it.err = ErrClosed
+			} else {
+				it.value, it.err = it.db.read(e)
+			}
+		}
+		it.db.lock.RUnlock()
+		// skip the keys deleted since the iterator was created
+		if ok && it.err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the key at the current position.
+func (it *Iterator) Key() []byte {
+	return []byte(it.keys[it.pos])
+}
+
+// Value returns the value at the current position.
+func (it *Iterator) Value() []byte {
+	return it.value
+}
+
+// Error returns the error that stopped the iteration, if any.
+func (it *Iterator) Error() error {
+	return it.err
+}
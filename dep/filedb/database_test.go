@@ -0,0 +1,229 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package filedb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPutGetDelete(t *testing.T) {
+	db, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := db.Has([]byte("key")); !ok {
+		t.Error("key missing after put")
+	}
+	if value, err := db.Get([]byte("key")); err != nil || !bytes.Equal(value, []byte("value")) {
+		t.Errorf("get mismatch: have %q, %v", value, err)
+	}
+	if err := db.Delete([]byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get([]byte("key")); err != ErrNotFound {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrNotFound)
+	}
+	db.Close()
+	if err := db.Put([]byte("key"), nil); err != ErrClosed {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := New(dir)
+	batch := db.NewBatch()
+	for i := 0; i < 100; i++ {
+		batch.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("key-000"), []byte("overwritten"))
+	db.Delete([]byte("key-001"))
+	db.Close()
+
+	db, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Len() != 99 {
+		t.Errorf("key count mismatch: have %d, want 99", db.Len())
+	}
+	if value, _ := db.Get([]byte("key-000")); !bytes.Equal(value, []byte("overwritten")) {
+		t.Errorf("overwritten value mismatch: have %q", value)
+	}
+	if ok, _ := db.Has([]byte("key-001")); ok {
+		t.Error("deleted key present after reopen")
+	}
+	if value, _ := db.Get([]byte("key-099")); !bytes.Equal(value, []byte("value-99")) {
+		t.Errorf("value mismatch: have %q", value)
+	}
+}
+
+func TestCrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := New(dir)
+	db.Put([]byte("a"), []byte("1"))
+	batch := db.NewBatch()
+	batch.Put([]byte("b"), []byte("2"))
+	batch.Put([]byte("c"), []byte("3"))
+	batch.Write()
+	db.Close()
+
+	// cut the last batch in half, as a crash during its write would
+	path := filepath.Join(dir, logName)
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := db.Has([]byte("b")); ok {
+		t.Error("partial batch applied")
+	}
+	if value, _ := db.Get([]byte("a")); !bytes.Equal(value, []byte("1")) {
+		t.Errorf("value mismatch: have %q", value)
+	}
+	// writes continue after the last valid record
+	db.Put([]byte("d"), []byte("4"))
+	db.Close()
+
+	db, _ = New(dir)
+	defer db.Close()
+	if value, _ := db.Get([]byte("d")); !bytes.Equal(value, []byte("4")) {
+		t.Errorf("value after recovery mismatch: have %q", value)
+	}
+}
+
+func TestCorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := New(dir)
+	db.Put([]byte("a"), []byte("1"))
+	db.Close()
+
+	// a header claiming a 4 GiB payload must not be allocated
+	path := filepath.Join(dir, logName)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 1, 2, 3})
+	f.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	db, err = New(dir)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("reopen allocated %d bytes", alloc)
+	}
+	if value, _ := db.Get([]byte("a")); !bytes.Equal(value, []byte("1")) {
+		t.Errorf("value mismatch: have %q", value)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := New(dir)
+	for i := 0; i < 50; i++ {
+		db.Put([]byte("key"), bytes.Repeat([]byte{byte(i)}, 1024))
+		db.Put([]byte(fmt.Sprintf("tmp-%d", i)), []byte("x"))
+		db.Delete([]byte(fmt.Sprintf("tmp-%d", i)))
+	}
+	db.Put([]byte("other"), []byte("value"))
+	before, _ := os.Stat(filepath.Join(dir, logName))
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(filepath.Join(dir, logName))
+	if after.Size() >= before.Size()/10 {
+		t.Errorf("log not compacted: %d -> %d bytes", before.Size(), after.Size())
+	}
+	if value, _ := db.Get([]byte("key")); !bytes.Equal(value, bytes.Repeat([]byte{49}, 1024)) {
+		t.Errorf("value mismatch after compaction")
+	}
+	db.Close()
+
+	db, _ = New(dir)
+	defer db.Close()
+	if db.Len() != 2 {
+		t.Errorf("key count mismatch after compaction: have %d, want 2", db.Len())
+	}
+}
+
+func TestCompactReopenFailure(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := New(dir)
+	defer db.Close()
+	db.Put([]byte("key"), []byte("value"))
+
+	// a directory in place of the log can be neither replaced nor opened
+	path := filepath.Join(dir, logName)
+	os.Remove(path)
+	os.MkdirAll(filepath.Join(path, "sub"), 0755)
+	if err := db.Compact(); err == nil {
+		t.Fatal("compaction succeeded without a log")
+	}
+	if _, err := db.Get([]byte("key")); err != ErrClosed {
+		t.Errorf("get error mismatch: have %v, want %v", err, ErrClosed)
+	}
+	if err := db.Put([]byte("key"), []byte("other")); err != ErrClosed {
+		t.Errorf("put error mismatch: have %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestIteratorWithPrefix(t *testing.T) {
+	db, _ := New(t.TempDir())
+	defer db.Close()
+	for _, key := range []string{"b-2", "a-1", "b-1", "c-1", "b-3"} {
+		db.Put([]byte(key), []byte("v"+key))
+	}
+	it := db.NewIteratorWithPrefix([]byte("b-"))
+	db.Delete([]byte("b-2"))
+
+	var keys []string
+	for it.Next() {
+		if !bytes.Equal(it.Value(), append([]byte("v"), it.Key()...)) {
+			t.Errorf("value mismatch for %s: %q", it.Key(), it.Value())
+		}
+		keys = append(keys, string(it.Key()))
+	}
+	if it.Error() != nil {
+		t.Fatal(it.Error())
+	}
+	if fmt.Sprint(keys) != "[b-1 b-3]" {
+		t.Errorf("keys mismatch: have %v", keys)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package statedb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/utils/rlp"
+)
+
+// DumpAsset is the metadata of an issued asset.
+type DumpAsset struct {
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Total    string `json:"total"`
+	Decimals uint64 `json:"decimals"`
+	Owner    string `json:"owner"`
+}
+
+// DumpAccount is the state of a single account: its nonce, code, storage
+// and the balance of every asset it holds, keyed by asset address.
+type DumpAccount struct {
+	Nonce     uint64            `json:"nonce"`
+	Root      string            `json:"root"`
+	AssetRoot string            `json:"assetRoot"`
+	CodeHash  string            `json:"codeHash"`
+	Code      string            `json:"code"`
+	Storage   map[string]string `json:"storage"`
+	Balances  map[string]string `json:"balances"`
+}
+
+// Dump is the full state of the accounts and the issued assets.
+type Dump struct {
+	Root     string                 `json:"root"`
+	Accounts map[string]DumpAccount `json:"accounts"`
+	Assets   map[string]DumpAsset   `json:"assets"`
+}
+
+// RawDump returns the state of every account in the state trie, it reflects
+// the changes up to the last IntermediateRoot or Commit. Nonces, balances and
+// assets are records of the asset ledger and are filled in by asset.RawDump.
+func (self *StateDB) RawDump() Dump {
+	dump := Dump{
+		Root:     fmt.Sprintf("%x", self.trie.Hash()),
+		Accounts: make(map[string]DumpAccount),
+		Assets:   make(map[string]DumpAsset),
+	}
+	it := self.trie.NewIterator()
+	for it.Next() {
+		addr := common.BytesToAddress(self.trie.GetKey(it.Key))
+		obj := self.getStateObject(addr)
+		if obj == nil {
+			continue
+		}
+		data := obj.data
+		account := DumpAccount{
+			Root:      common.Bytes2Hex(data.StRoot[:]),
+			AssetRoot: common.Bytes2Hex(data.AtRoot[:]),
+			CodeHash:  common.Bytes2Hex(data.CodeHash),
+			Code:      common.Bytes2Hex(obj.Code()),
+			Storage:   make(map[string]string),
+			Balances:  make(map[string]string),
+		}
+		storageIt := obj.getTrie(STROOTFlAG).NewIterator()
+		for storageIt.Next() {
+			_, content, _, err := rlp.Split(storageIt.Value)
+			if err != nil {
+				self.setError(err)
+				continue
+			}
+			key := obj.getTrie(STROOTFlAG).GetKey(storageIt.Key)
+			account.Storage[common.Bytes2Hex(key)] = common.Bytes2Hex(content)
+		}
+		self.setError(storageIt.Err)
+
+		dump.Accounts[common.Bytes2Hex(addr[:])] = account
+	}
+	self.setError(it.Err)
+	return dump
+}
+
+// Dump returns the RawDump of the state as indented JSON. The keys of every
+// object are sorted, so equal states produce equal dumps.
+func (self *StateDB) Dump() ([]byte, error) {
+	return json.MarshalIndent(self.RawDump(), "", "    ")
+}
@@ -71,6 +71,10 @@ type (
 	resetObjectChange struct {
 		prev *stateObject
 	}
+	suicideChange struct {
+		account *common.Address
+		prev    bool // whether account had already suicided
+	}
 
 	storageChange struct {
 		account       *common.Address
@@ -92,6 +96,9 @@ type (
 	addLogChange struct {
 		txhash common.Hash
 	}
+	addInternalTxChange struct {
+		txhash common.Hash
+	}
 	addPreimageChange struct {
 		hash common.Hash
 	}
@@ -114,6 +121,17 @@ func (ch resetObjectChange) dirtied() *common.Address {
 	return nil
 }
 
+func (ch suicideChange) revert(s *StateDB) {
+	obj := s.getStateObject(*ch.account)
+	if obj != nil {
+		obj.suicided = ch.prev
+	}
+}
+
+func (ch suicideChange) dirtied() *common.Address {
+	return ch.account
+}
+
 var ripemd = common.HexToAddress("0000000000000000000000000000000000000003")
 
 func (ch codeChange) revert(s *StateDB) {
@@ -133,6 +151,11 @@ func (ch storageChange) dirtied() *common.Address {
 }
 
 func (ch accountChange) revert(s *StateDB) {
+	// A nil previous value means the key did not exist before the change.
+	if ch.prevalue == nil {
+		s.getStateObject(*ch.account).deleteAccount(ch.key)
+		return
+	}
 	s.getStateObject(*ch.account).setAccount(ch.key, ch.prevalue)
 }
 
@@ -162,6 +185,20 @@ func (ch addLogChange) dirtied() *common.Address {
 	return nil
 }
 
+func (ch addInternalTxChange) revert(s *StateDB) {
+	itxs := s.internalTxs[ch.txhash]
+	if len(itxs) == 1 {
+		delete(s.internalTxs, ch.txhash)
+	} else {
+		s.internalTxs[ch.txhash] = itxs[:len(itxs)-1]
+	}
+	s.internalTxSize--
+}
+
+func (ch addInternalTxChange) dirtied() *common.Address {
+	return nil
+}
+
 func (ch addPreimageChange) revert(s *StateDB) {
 	delete(s.preimages, ch.hash)
 }
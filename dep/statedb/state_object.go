@@ -18,9 +18,13 @@ package statedb
 
 import (
 	"bytes"
-    "github.com/vm-project/common"
-	"github.com/vm-project/dep/crypto"
+	"fmt"
+	"io"
 
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/crypto"
+	"github.com/vm-project/dep/trie"
+	"github.com/vm-project/utils/rlp"
 )
 
 var (
@@ -64,8 +68,8 @@ type stateObject struct {
 
 	dbErr error
 
-	//sttrie Trie // storage trie, which becomes non-nil on first access
-	//attrie Trie
+	sttrie *trie.SecureTrie // storage trie, which becomes non-nil on first access
+	attrie *trie.SecureTrie // asset trie, which becomes non-nil on first access
 	code   []byte
 	//dataValue  map[string][]byte
     //
@@ -75,17 +79,22 @@ type stateObject struct {
 	cachedStorage map[common.Hash]common.Hash // Storage entry cache to avoid duplicate reads
 	dirtyStorage  map[common.Hash]common.Hash // Storage entries that need to be flushed to disk
 
+	// When an object is marked suicided it will be deleted once the state
+	// is finalised at the end of the transaction.
+	suicided  bool
 	deleted   bool
 	dirtyCode bool // true if the code was updated
 }
 
 func (s *stateObject) empty() bool {
-	return bytes.Equal(s.data.AtRoot[:], emptyHash[:]) && bytes.Equal(s.data.CodeHash, emptyCodeHash) && len(s.cacheAccount) == 0
+	return s.data.AtRoot == trie.EmptyRoot && bytes.Equal(s.data.CodeHash, emptyCodeHash) && len(s.cacheAccount) == 0
 }
 
+// Account is the consensus representation of accounts.
+// These objects are stored in the main account trie.
 type Account struct {
 	StRoot   common.Hash // merkle root of the storage trie
-	AtRoot   common.Hash
+	AtRoot   common.Hash // merkle root of the asset trie
 	CodeHash []byte
 }
 
@@ -93,6 +102,12 @@ func newObject(db *StateDB, address common.Address, data Account) *stateObject {
 	if data.CodeHash == nil {
 		data.CodeHash = emptyCodeHash
 	}
+	if data.StRoot == (common.Hash{}) {
+		data.StRoot = trie.EmptyRoot
+	}
+	if data.AtRoot == (common.Hash{}) {
+		data.AtRoot = trie.EmptyRoot
+	}
 	return &stateObject{
 		db:            db,
 		address:       address,
@@ -105,9 +120,14 @@ func newObject(db *StateDB, address common.Address, data Account) *stateObject {
 	}
 }
 
-//func (c *stateObject) EncodeRLP(w io.Writer) error {
-//	return rlp.Encode(w, c.data)
-//}
+func (self *stateObject) markSuicided() {
+	self.suicided = true
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (c *stateObject) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, c.data)
+}
 
 func (self *stateObject) setError(err error) {
 	if self.dbErr == nil {
@@ -115,32 +135,58 @@ func (self *stateObject) setError(err error) {
 	}
 }
 
-//func (c *stateObject) getTrie(db Database, root common.Hash, flag int) Trie {
-//	var tr Trie
-//	var err error
-//	if flag == STROOTFlAG {
-//		if c.sttrie != nil {
-//			return c.sttrie
-//		}
-//		tr, err = db.OpenStorageTrie(c.addrHash, root)
-//		if err != nil {
-//			tr, _ = db.OpenStorageTrie(c.addrHash, common.Hash{})
-//			c.setError(fmt.Errorf("can't create storage trie: %v", err))
-//		}
-//		c.sttrie = tr
-//	} else {
-//		if c.attrie != nil {
-//			return c.attrie
-//		}
-//		tr, err = db.OpenStorageTrie(c.addrHash, root)
-//		if err != nil {
-//			tr, _ = db.OpenStorageTrie(c.addrHash, common.Hash{})
-//			c.setError(fmt.Errorf("can't create storage trie: %v", err))
-//		}
-//		c.attrie = tr
-//	}
-//	return tr
-//}
+func (c *stateObject) getTrie(flag int) *trie.SecureTrie {
+	tr, root := c.sttrie, c.data.StRoot
+	if flag == ATROOTFlAG {
+		tr, root = c.attrie, c.data.AtRoot
+	}
+	if tr != nil {
+		return tr
+	}
+	tr, err := trie.NewSecure(root, c.db.db)
+	if err != nil {
+		tr, _ = trie.NewSecure(common.Hash{}, c.db.db)
+		c.setError(fmt.Errorf("can't create storage trie: %v", err))
+	}
+	if flag == ATROOTFlAG {
+		c.attrie = tr
+	} else {
+		c.sttrie = tr
+	}
+	return tr
+}
+
+// updateTrie writes cached storage and asset modifications into the object's
+// tries.
+func (self *stateObject) updateTrie() {
+	tr := self.getTrie(STROOTFlAG)
+	for key, value := range self.dirtyStorage {
+		delete(self.dirtyStorage, key)
+		if (value == common.Hash{}) {
+			self.setError(tr.TryDelete(key[:]))
+			continue
+		}
+		// Encoding []byte cannot fail, ok to ignore the error.
+		v, _ := rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
+		self.setError(tr.TryUpdate(key[:], v))
+	}
+	tr = self.getTrie(ATROOTFlAG)
+	for key, value := range self.dirtyAccount {
+		delete(self.dirtyAccount, key)
+		if len(value) == 0 {
+			self.setError(tr.TryDelete([]byte(key)))
+			continue
+		}
+		self.setError(tr.TryUpdate([]byte(key), value))
+	}
+}
+
+// updateRoot sets the storage and asset trie roots to the current root hashes.
+func (self *stateObject) updateRoot() {
+	self.updateTrie()
+	self.data.StRoot = self.getTrie(STROOTFlAG).Hash()
+	self.data.AtRoot = self.getTrie(ATROOTFlAG).Hash()
+}
 
 func (self *stateObject) GetState(key common.Hash) common.Hash {
 	value, exists := self.cachedStorage[key]
@@ -148,22 +194,20 @@ func (self *stateObject) GetState(key common.Hash) common.Hash {
 		return value
 	}
 	// Load from DB in case it is missing.
-	//enc, err := self.getTrie(db, self.data.StRoot, STROOTFlAG).TryGet(key[:])
-	//if err != nil {
-	//	self.setError(err)
-	//	return common.Hash{}
-	//}
-	//
-	//if len(enc) > 0 {
-	//	_, content, _, err := rlp.Split(enc)
-	//	if err != nil {
-	//		self.setError(err)
-	//	}
-	//	value.SetBytes(content)
-	//	self.cachedStorage[key] = value
-	//	return value
-	//}
-	return common.Hash{}
+	enc, err := self.getTrie(STROOTFlAG).TryGet(key[:])
+	if err != nil {
+		self.setError(err)
+		return common.Hash{}
+	}
+	if len(enc) > 0 {
+		_, content, _, err := rlp.Split(enc)
+		if err != nil {
+			self.setError(err)
+		}
+		value.SetBytes(content)
+	}
+	self.cachedStorage[key] = value
+	return value
 }
 
 // SetState updates a value in account storage.
@@ -186,24 +230,28 @@ func (self *stateObject) GetAccount(key string) []byte {
 	if exists {
 		return value
 	}
-	//enc, err := self.getTrie(db, self.data.AtRoot, ATROOTFlAG).TryGet([]byte(key))
-	//enc = self.dataValue[key]
-	//if err != nil {
-	//	self.setError(err)
-	//	return []byte{}
-	//}
-	//self.cacheAccount[key] = enc
-	return self.cacheAccount[key]
+	// A deletion not yet written to the trie hides the stored value.
+	if value, exists := self.dirtyAccount[key]; exists {
+		return value
+	}
+	enc, err := self.getTrie(ATROOTFlAG).TryGet([]byte(key))
+	if err != nil {
+		self.setError(err)
+		return nil
+	}
+	if enc != nil {
+		self.cacheAccount[key] = enc
+	}
+	return enc
 }
 
 func (self *stateObject) SetAccount(key string, value []byte) {
-	//self.db.journal.append(accountChange{
-	//	account:  &self.address,
-	//	key:      key,
-	//	prevalue: self.GetAccount(db, key),
-	//})
+	self.db.journal.append(accountChange{
+		account:  &self.address,
+		key:      key,
+		prevalue: self.GetAccount(key),
+	})
 	self.setAccount(key, value)
-
 }
 
 func (self *stateObject) setAccount(key string, value []byte) {
@@ -222,7 +270,8 @@ func (self *stateObject) DeleteAccount( key string) {
 
 func (self *stateObject) deleteAccount(key string) {
 	delete(self.cacheAccount, key)
-	delete(self.dirtyAccount, key)
+	// a nil dirty value removes the key from the asset trie
+	self.dirtyAccount[key] = nil
 }
 
 func (self *stateObject) Code() []byte {
@@ -232,12 +281,12 @@ func (self *stateObject) Code() []byte {
 	if bytes.Equal(self.CodeHash(), emptyCodeHash) {
 		return nil
 	}
-	//code, err := db.TrieDB().Node(common.BytesToHash(self.CodeHash()))
-	//if err != nil {
-	//	self.setError(fmt.Errorf("can't load code hash %x: %v", self.CodeHash(), err))
-	//}
-	//self.code = code
-	return self.code
+	code, err := self.db.db.Get(self.CodeHash())
+	if err != nil {
+		self.setError(fmt.Errorf("can't load code hash %x: %v", self.CodeHash(), err))
+	}
+	self.code = code
+	return code
 }
 //use
 func (self *stateObject) SetCode(codeHash common.Hash, code []byte) {
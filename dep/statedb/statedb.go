@@ -17,10 +17,15 @@
 package statedb
 
 import (
+	"fmt"
+	"sort"
 	"sync"
     "github.com/vm-project/common"
 	"github.com/vm-project/dep/crypto"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/dep/trie"
 	"github.com/vm-project/types"
+	"github.com/vm-project/utils/rlp"
 )
 //type commAddress [AddressLength]byte
 type revision struct {
@@ -61,9 +66,8 @@ type Log struct {
 	Removed bool `json:"removed"`
 }
 type StateDB struct {
-	//db   Database
-	//trie Trie
-    //
+	db   memdb.Database    // node database of the tries, nil keeps them in memory
+	trie *trie.SecureTrie // account trie
 	stateObjects      map[common.Address]*stateObject
 
 	stateObjectsDirty map[common.Address]struct{}
@@ -73,32 +77,39 @@ type StateDB struct {
 	dbErr  error
 	refund uint64
 
-	//thash, bhash common.Hash
-	//txIndex      int
+	// transaction context of the logs added by AddLog, set by Prepare
+	thash   common.Hash
+	txIndex int
 	//addlog
 	logs    map[common.Hash][]*types.Log
 	logSize uint
+	// asset movements added by AddInternalTx
+	internalTxs    map[common.Hash][]*types.InternalTx
+	internalTxSize uint
     // ?
 	preimages map[common.Hash][]byte
 
 	journal        *journal
-	//validRevisions []revision
-	//nextRevisionId int
+	validRevisions []revision
+	nextRevisionId int
 
 	lock sync.Mutex
 }
 
-func New(root common.Hash ) (*StateDB, error) {
-	//tr, err := db.OpenTrie(root)
-	//if err != nil {
-	//	return nil, err
-	//}
+// New creates a new state from a given trie root. Accounts, storage, asset
+// records and code are loaded lazily from db.
+func New(root common.Hash, db memdb.Database) (*StateDB, error) {
+	tr, err := trie.NewSecure(root, db)
+	if err != nil {
+		return nil, err
+	}
 	return &StateDB{
-		//db:                db,
-		//trie:              tr,
+		db:                db,
+		trie:              tr,
 		stateObjects:      make(map[common.Address]*stateObject),
-		//stateObjectsDirty: make(map[common.Address]struct{}),
+		stateObjectsDirty: make(map[common.Address]struct{}),
 		logs:              make(map[common.Hash][]*types.Log),
+		internalTxs:       make(map[common.Hash][]*types.InternalTx),
 		preimages:         make(map[common.Hash][]byte),
 		journal:           newJournal(),
 	}, nil
@@ -115,47 +126,74 @@ func (self *StateDB) Error() error {
 }
 
 func (self *StateDB) Reset(root common.Hash) error {
-	//tr, err := self.db.OpenTrie(root)
-	//if err != nil {
-	//	return err
-	//}
-	//self.trie = tr
+	tr, err := trie.NewSecure(root, self.db)
+	if err != nil {
+		return err
+	}
+	self.trie = tr
 	self.stateObjects = make(map[common.Address]*stateObject)
 	self.stateObjectsDirty = make(map[common.Address]struct{})
-	//self.thash = common.Hash{}
-	//self.bhash = common.Hash{}
-	//self.txIndex = 0
+	self.thash = common.Hash{}
+	self.txIndex = 0
 	self.logs = make(map[common.Hash][]*types.Log)
 	self.logSize = 0
+	self.internalTxs = make(map[common.Hash][]*types.InternalTx)
+	self.internalTxSize = 0
 	self.preimages = make(map[common.Hash][]byte)
-	//self.clearJournalAndRefund()
+	self.clearJournalAndRefund()
 	return nil
 }
 
+// AddLog records log under the transaction set by Prepare. The log index
+// counts every log added since the last Reset, so it is unique within a block.
 func (self *StateDB) AddLog(log *Log) {
-	//self.journal.append(addLogChange{txhash: self.thash})
-	//
-	//log.TxHash = self.thash
-	//log.BlockHash = self.bhash
-	//log.TxIndex = uint(self.txIndex)
-	//log.Index = self.logSize
-	//self.logs[self.thash] = append(self.logs[self.thash], log)
+	self.journal.append(addLogChange{txhash: self.thash})
+
+	self.logs[self.thash] = append(self.logs[self.thash], &types.Log{
+		Address:     log.Address,
+		Topics:      log.Topics,
+		Data:        log.Data,
+		BlockNumber: log.BlockNumber,
+		TxHash:      self.thash,
+		TxIndex:     uint(self.txIndex),
+		Index:       self.logSize,
+	})
 	self.logSize++
 }
 
+// GetLogs returns the logs added by the transaction hash in emission order.
 func (self *StateDB) GetLogs(hash common.Hash) []*types.Log {
 	return self.logs[hash]
 }
 
-
+// Logs returns all the logs added since the last Reset in emission order.
 func (self *StateDB) Logs() []*types.Log {
 	var logs []*types.Log
 	for _, lgs := range self.logs {
 		logs = append(logs, lgs...)
 	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
 	return logs
 }
 
+// AddInternalTx records an asset movement of the current transaction, it is
+// dropped again if the call that made it is reverted.
+func (self *StateDB) AddInternalTx(itx *types.InternalTx) {
+	self.journal.append(addInternalTxChange{txhash: self.thash})
+
+	itx.TxHash = self.thash
+	itx.TxIndex = uint(self.txIndex)
+	itx.Index = self.internalTxSize
+	self.internalTxs[self.thash] = append(self.internalTxs[self.thash], itx)
+	self.internalTxSize++
+}
+
+// GetInternalTxs returns the asset movements of the transaction hash in the
+// order they were made.
+func (self *StateDB) GetInternalTxs(hash common.Hash) []*types.InternalTx {
+	return self.internalTxs[hash]
+}
+
 func (self *StateDB) AddPreimage(hash common.Hash, preimage []byte) {
 	if _, ok := self.preimages[hash]; !ok {
 		self.journal.append(addPreimageChange{hash: hash})
@@ -178,6 +216,31 @@ func (self *StateDB) Exist(addr common.Address) bool {
 	return self.getStateObject(addr) != nil
 }
 
+// Suicide marks the given account as suicided.
+//
+// The account's state object is still available until the state is finalised,
+// getStateObject will return a non-nil account after Suicide.
+func (self *StateDB) Suicide(addr common.Address) bool {
+	stateObject := self.getStateObject(addr)
+	if stateObject == nil {
+		return false
+	}
+	self.journal.append(suicideChange{
+		account: &addr,
+		prev:    stateObject.suicided,
+	})
+	stateObject.markSuicided()
+	return true
+}
+
+func (self *StateDB) HasSuicided(addr common.Address) bool {
+	stateObject := self.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.suicided
+	}
+	return false
+}
+
 func (self *StateDB) Empty(addr common.Address) bool {
 	so := self.getStateObject(addr)
 	return so == nil || so.empty()
@@ -195,14 +258,7 @@ func (self *StateDB) GetCodeSize(addr common.Address) int {
 	if stateObject == nil {
 		return 0
 	}
-	if stateObject.code != nil {
-		return len(stateObject.code)
-	}
-	//size, err := self.db.ContractCodeSize(stateObject.addrHash, common.BytesToHash(stateObject.CodeHash()))
-	//if err != nil {
-	//	self.setError(err)
-	//}
-	return 0
+	return len(stateObject.Code())
 }
 func (self *StateDB) SetCode(addr common.Address, code []byte) {
 	stateObject := self.GetOrNewStateObject(addr)
@@ -263,6 +319,22 @@ func (self *StateDB) DeleteAccount(addr common.Address, key string) {
 
 
 
+// updateStateObject writes the given object to the trie.
+func (self *StateDB) updateStateObject(stateObject *stateObject) {
+	addr := stateObject.Address()
+	data, err := rlp.EncodeToBytes(stateObject)
+	if err != nil {
+		panic(fmt.Errorf("can't encode object at %x: %v", addr[:], err))
+	}
+	self.setError(self.trie.TryUpdate(addr[:], data))
+}
+
+// deleteStateObject removes the given object from the state trie.
+func (self *StateDB) deleteStateObject(stateObject *stateObject) {
+	addr := stateObject.Address()
+	self.setError(self.trie.TryDelete(addr[:]))
+}
+
 func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObject) {
 	// Prefer 'live' objects.
 	if obj := self.stateObjects[addr]; obj != nil {
@@ -272,16 +344,17 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		return obj
 	}
 
-	//enc, err := self.trie.TryGet(addr[:])
-	//if len(enc) == 0 {
-	//	self.setError(err)
-	//	return nil
-	//}
+	// Load the object from the database.
+	enc, err := self.trie.TryGet(addr[:])
+	if len(enc) == 0 {
+		self.setError(err)
+		return nil
+	}
 	var data Account
-	//if err := rlp.DecodeBytes(enc, &data); err != nil {
-	//	log.Error("Failed to decode state object", "addr", addr, "err", err)
-	//	return nil
-	//}
+	if err := rlp.DecodeBytes(enc, &data); err != nil {
+		self.setError(fmt.Errorf("can't decode state object %x: %v", addr[:], err))
+		return nil
+	}
 	obj := newObject(self, addr, data)
 	self.setStateObject(obj)
 	return obj
@@ -320,25 +393,43 @@ func (self *StateDB) CreateAccount(addr common.Address) {
 	self.createObject(addr)
 }
 
-//func (db *StateDB) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) {
-//	so := db.getStateObject(addr)
-//	if so == nil {
-//		return
-//	}
-//
-//	// When iterating over the storage check the cache first
-//	for h, value := range so.cachedStorage {
-//		cb(h, value)
-//	}
-//
-//	it := trie.NewIterator(so.getTrie(db.db, so.data.StRoot, STROOTFlAG).NodeIterator(nil))
-//	for it.Next() {
-//		key := common.BytesToHash(db.trie.GetKey(it.Key))
-//		if _, ok := so.cachedStorage[key]; !ok {
-//			cb(key, common.BytesToHash(it.Value))
-//		}
-//	}
-//}
+// ForEachStorage calls cb with every storage slot of addr, including the
+// changes not yet written to its trie, until cb returns false.
+func (db *StateDB) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) {
+	so := db.getStateObject(addr)
+	if so == nil {
+		return
+	}
+
+	// When iterating over the storage check the cache first, cleared slots
+	// are cached as zero and skipped
+	for h, value := range so.cachedStorage {
+		if value == (common.Hash{}) {
+			continue
+		}
+		if !cb(h, value) {
+			return
+		}
+	}
+
+	tr := so.getTrie(STROOTFlAG)
+	it := tr.NewIterator()
+	for it.Next() {
+		key := common.BytesToHash(tr.GetKey(it.Key))
+		if _, ok := so.cachedStorage[key]; ok {
+			continue
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			db.setError(err)
+			continue
+		}
+		if !cb(key, common.BytesToHash(content)) {
+			return
+		}
+	}
+	db.setError(it.Err)
+}
 
 //func (self *StateDB) Copy() *StateDB {
 //	self.lock.Lock()
@@ -378,25 +469,28 @@ func (self *StateDB) CreateAccount(addr common.Address) {
 //	return state
 //}
 
+// Snapshot returns an identifier for the current revision of the state.
 func (self *StateDB) Snapshot() int {
-	//id := self.nextRevisionId
-	//self.nextRevisionId++
-	//self.validRevisions = append(self.validRevisions, revision{id, self.journal.length()})
-	var id int
+	id := self.nextRevisionId
+	self.nextRevisionId++
+	self.validRevisions = append(self.validRevisions, revision{id, self.journal.length()})
 	return id
 }
 
+// RevertToSnapshot reverts all state changes made since the given revision.
 func (self *StateDB) RevertToSnapshot(revid int) {
-	//idx := sort.Search(len(self.validRevisions), func(i int) bool {
-	//	return self.validRevisions[i].id >= revid
-	//})
-	//if idx == len(self.validRevisions) || self.validRevisions[idx].id != revid {
-	//	panic(fmt.Errorf("revision id %v cannot be reverted", revid))
-	//}
-	//snapshot := self.validRevisions[idx].journalIndex
-	//
-	//self.journal.revert(self, snapshot)
-	//self.validRevisions = self.validRevisions[:idx]
+	// Find the snapshot in the stack of valid snapshots.
+	idx := sort.Search(len(self.validRevisions), func(i int) bool {
+		return self.validRevisions[i].id >= revid
+	})
+	if idx == len(self.validRevisions) || self.validRevisions[idx].id != revid {
+		panic(fmt.Errorf("revision id %v cannot be reverted", revid))
+	}
+	snapshot := self.validRevisions[idx].journalIndex
+
+	// Replay the journal to undo changes and remove invalidated snapshots
+	self.journal.revert(self, snapshot)
+	self.validRevisions = self.validRevisions[:idx]
 }
 
 func (self *StateDB) GetRefund() uint64 {
@@ -404,21 +498,98 @@ func (self *StateDB) GetRefund() uint64 {
 }
 
 
-//func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
-//	s.Finalise(deleteEmptyObjects)
-//	return s.trie.Hash()
-//}
-//
-//func (self *StateDB) Prepare(thash, bhash common.Hash, ti int) {
-//	self.thash = thash
-//	self.bhash = bhash
-//	self.txIndex = ti
-//}
-//
-//func (s *StateDB) clearJournalAndRefund() {
-//	s.journal = newJournal()
-//	s.validRevisions = s.validRevisions[:0]
-//	s.refund = 0
-//}
+// IntermediateRoot computes the current root hash of the state trie.
+// It is called in between transactions to get the root hash that
+// goes into transaction receipts.
+func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
+	s.Finalise(deleteEmptyObjects)
+	for addr := range s.stateObjectsDirty {
+		stateObject := s.stateObjects[addr]
+		if stateObject.deleted {
+			s.deleteStateObject(stateObject)
+		} else {
+			stateObject.updateRoot()
+			s.updateStateObject(stateObject)
+		}
+		s.setError(stateObject.dbErr)
+	}
+	return s.trie.Hash()
+}
+
+// Prepare sets the current transaction hash and index which are used when
+// the EVM emits new state logs.
+func (self *StateDB) Prepare(thash common.Hash, ti int) {
+	self.thash = thash
+	self.txIndex = ti
+}
+
+// TxHash returns the hash of the transaction set by Prepare.
+func (self *StateDB) TxHash() common.Hash {
+	return self.thash
+}
+
+// Finalise finalises the state by removing the suicided objects and, if
+// deleteEmptyObjects is set, the touched empty ones. It is called at the end
+// of every transaction and clears the journal and refunds.
+func (s *StateDB) Finalise(deleteEmptyObjects bool) {
+	for addr := range s.journal.dirties {
+		stateObject, exist := s.stateObjects[addr]
+		if !exist {
+			continue
+		}
+		if stateObject.suicided || (deleteEmptyObjects && stateObject.empty()) {
+			stateObject.deleted = true
+		}
+		s.stateObjectsDirty[addr] = struct{}{}
+	}
+	s.clearJournalAndRefund()
+}
+
+// Commit writes the state to the database through a single batch: the code
+// of the dirty objects, their storage and asset tries and the account trie.
+// It returns the new root, from which New can reopen the state.
+func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error) {
+	s.IntermediateRoot(deleteEmptyObjects)
+	// Don't write a state built on top of records that failed to load
+	if s.dbErr != nil {
+		return common.Hash{}, s.dbErr
+	}
+	batch := s.db.NewBatch()
+	for addr := range s.stateObjectsDirty {
+		stateObject := s.stateObjects[addr]
+		if stateObject.deleted {
+			continue
+		}
+		// Write any contract code associated with the state object
+		if stateObject.code != nil && stateObject.dirtyCode {
+			if err := batch.Put(stateObject.CodeHash(), stateObject.code); err != nil {
+				return common.Hash{}, err
+			}
+			stateObject.dirtyCode = false
+		}
+		// Write any storage and asset changes in the state object to their tries
+		if _, err := stateObject.getTrie(STROOTFlAG).Commit(batch); err != nil {
+			return common.Hash{}, err
+		}
+		if _, err := stateObject.getTrie(ATROOTFlAG).Commit(batch); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	// Write the account trie changes and flush everything at once
+	if root, err = s.trie.Commit(batch); err != nil {
+		return common.Hash{}, err
+	}
+	if err = batch.Write(); err != nil {
+		return common.Hash{}, err
+	}
+	s.stateObjectsDirty = make(map[common.Address]struct{})
+	return root, nil
+}
+
+func (s *StateDB) clearJournalAndRefund() {
+	s.journal = newJournal()
+	s.validRevisions = s.validRevisions[:0]
+	s.refund = 0
+}
 
 
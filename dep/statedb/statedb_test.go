@@ -0,0 +1,302 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package statedb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/dep/trie"
+)
+
+func TestSnapshotNested(t *testing.T) {
+	state, _ := New(common.Hash{}, memdb.NewMemDatabase())
+	addr := common.BytesToAddress([]byte("contract"))
+	key := common.BytesToHash([]byte("slot"))
+
+	state.SetState(addr, key, common.BytesToHash([]byte{1}))
+	outer := state.Snapshot()
+
+	state.SetState(addr, key, common.BytesToHash([]byte{2}))
+	state.SetCode(addr, []byte{0x60, 0x00})
+	inner := state.Snapshot()
+
+	state.SetState(addr, key, common.BytesToHash([]byte{3}))
+	state.AddRefund(100)
+
+	state.RevertToSnapshot(inner)
+	if got := state.GetState(addr, key); got != common.BytesToHash([]byte{2}) {
+		t.Errorf("inner revert: storage mismatch: have %x, want %x", got, []byte{2})
+	}
+	if state.GetRefund() != 0 {
+		t.Errorf("inner revert: refund mismatch: have %d, want 0", state.GetRefund())
+	}
+	if code := state.GetCode(addr); !bytes.Equal(code, []byte{0x60, 0x00}) {
+		t.Errorf("inner revert: code mismatch: have %x", code)
+	}
+
+	state.RevertToSnapshot(outer)
+	if got := state.GetState(addr, key); got != common.BytesToHash([]byte{1}) {
+		t.Errorf("outer revert: storage mismatch: have %x, want %x", got, []byte{1})
+	}
+	if code := state.GetCode(addr); len(code) != 0 {
+		t.Errorf("outer revert: code not reverted: have %x", code)
+	}
+}
+
+func TestSnapshotInvalidRevision(t *testing.T) {
+	state, _ := New(common.Hash{}, memdb.NewMemDatabase())
+	outer := state.Snapshot()
+	inner := state.Snapshot()
+	state.RevertToSnapshot(outer)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic when reverting to an invalidated revision")
+		}
+	}()
+	state.RevertToSnapshot(inner)
+}
+
+func TestExist(t *testing.T) {
+	db := memdb.NewMemDatabase()
+	state, _ := New(common.Hash{}, db)
+	addr := common.BytesToAddress([]byte("account"))
+
+	if state.Exist(addr) {
+		t.Fatal("untouched account exists")
+	}
+	snap := state.Snapshot()
+	state.CreateAccount(addr)
+	if !state.Exist(addr) {
+		t.Fatal("created account doesn't exist")
+	}
+	state.RevertToSnapshot(snap)
+	if state.Exist(addr) {
+		t.Fatal("reverted account still exists")
+	}
+	state.CreateAccount(addr)
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	state, _ = New(root, db)
+	if !state.Exist(addr) {
+		t.Error("committed account doesn't exist after reopen")
+	}
+	if state.Exist(common.BytesToAddress([]byte("other"))) {
+		t.Error("untouched account exists after reopen")
+	}
+}
+
+func TestLogs(t *testing.T) {
+	state, _ := New(common.Hash{}, memdb.NewMemDatabase())
+	addr := common.BytesToAddress([]byte("contract"))
+	tx1, tx2 := common.BytesToHash([]byte("tx1")), common.BytesToHash([]byte("tx2"))
+
+	state.Prepare(tx1, 0)
+	state.AddLog(&Log{Address: addr, Data: []byte{1}})
+	state.Prepare(tx2, 1)
+	state.AddLog(&Log{Address: addr, Data: []byte{2}})
+	snap := state.Snapshot()
+	state.AddLog(&Log{Address: addr, Data: []byte{3}})
+	state.RevertToSnapshot(snap)
+	state.AddLog(&Log{Address: addr, Data: []byte{4}})
+
+	if logs := state.GetLogs(tx1); len(logs) != 1 || logs[0].TxHash != tx1 || logs[0].TxIndex != 0 {
+		t.Fatalf("tx1 logs mismatch: %v", logs)
+	}
+	logs := state.Logs()
+	if len(logs) != 3 {
+		t.Fatalf("log count mismatch: have %d, want 3", len(logs))
+	}
+	for i, data := range []byte{1, 2, 4} {
+		if logs[i].Index != uint(i) || !bytes.Equal(logs[i].Data, []byte{data}) {
+			t.Errorf("log %d mismatch: index %d, data %x", i, logs[i].Index, logs[i].Data)
+		}
+	}
+	if logs[2].TxHash != tx2 || logs[2].TxIndex != 1 {
+		t.Errorf("tx2 log context mismatch: hash %x, index %d", logs[2].TxHash, logs[2].TxIndex)
+	}
+}
+
+func TestIntermediateRoot(t *testing.T) {
+	addr := common.BytesToAddress([]byte("contract"))
+	key := common.BytesToHash([]byte("slot"))
+
+	a, _ := New(common.Hash{}, memdb.NewMemDatabase())
+	if root := a.IntermediateRoot(false); root != trie.EmptyRoot {
+		t.Fatalf("empty state root mismatch: have %x, want %x", root, trie.EmptyRoot)
+	}
+	a.SetCode(addr, []byte{0x60, 0x00})
+	a.SetState(addr, key, common.BytesToHash([]byte{1}))
+	a.SetAccount(addr, "asset", []byte{0x2a})
+	root := a.IntermediateRoot(false)
+
+	// the same changes in another order produce the same root
+	b, _ := New(common.Hash{}, memdb.NewMemDatabase())
+	b.SetAccount(addr, "asset", []byte{0x2a})
+	b.SetState(addr, key, common.BytesToHash([]byte{1}))
+	b.SetCode(addr, []byte{0x60, 0x00})
+	if have := b.IntermediateRoot(false); have != root {
+		t.Fatalf("root mismatch: have %x, want %x", have, root)
+	}
+
+	// storage, asset data and code all contribute to the root
+	b.SetState(addr, key, common.BytesToHash([]byte{2}))
+	if b.IntermediateRoot(false) == root {
+		t.Error("storage change did not change the root")
+	}
+	b.SetState(addr, key, common.BytesToHash([]byte{1}))
+	b.DeleteAccount(addr, "asset")
+	if b.IntermediateRoot(false) == root {
+		t.Error("asset change did not change the root")
+	}
+	b.SetAccount(addr, "asset", []byte{0x2a})
+	b.SetCode(addr, []byte{0x60, 0x01})
+	if b.IntermediateRoot(false) == root {
+		t.Error("code change did not change the root")
+	}
+	b.SetCode(addr, []byte{0x60, 0x00})
+	if have := b.IntermediateRoot(false); have != root {
+		t.Errorf("restored root mismatch: have %x, want %x", have, root)
+	}
+
+	// suicided accounts are removed from the trie
+	b.Suicide(addr)
+	if have := b.IntermediateRoot(false); have != trie.EmptyRoot {
+		t.Errorf("root after suicide mismatch: have %x, want %x", have, trie.EmptyRoot)
+	}
+}
+
+func TestCommitReopen(t *testing.T) {
+	db := memdb.NewMemDatabase()
+	addr := common.BytesToAddress([]byte("contract"))
+	key := common.BytesToHash([]byte("slot"))
+	code := []byte{0x60, 0x00}
+
+	state, _ := New(common.Hash{}, db)
+	state.SetCode(addr, code)
+	state.SetState(addr, key, common.BytesToHash([]byte{1}))
+	state.SetAccount(addr, "asset", []byte{0x2a})
+	state.SetAccount(addr, "gone", []byte{0x01})
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	if have := state.IntermediateRoot(false); have != root {
+		t.Fatalf("root changed after commit: have %x, want %x", have, root)
+	}
+
+	reopened, err := New(root, db)
+	if err != nil {
+		t.Fatalf("can't reopen state: %v", err)
+	}
+	if have := reopened.GetCode(addr); !bytes.Equal(have, code) {
+		t.Errorf("code mismatch: have %x, want %x", have, code)
+	}
+	if have := reopened.GetCodeSize(addr); have != len(code) {
+		t.Errorf("code size mismatch: have %d, want %d", have, len(code))
+	}
+	if have := reopened.GetState(addr, key); have != common.BytesToHash([]byte{1}) {
+		t.Errorf("storage mismatch: have %x", have)
+	}
+	if have := reopened.GetAccount(addr, "asset"); !bytes.Equal(have, []byte{0x2a}) {
+		t.Errorf("asset record mismatch: have %x", have)
+	}
+
+	// changes on top of the reopened state commit to a new root
+	reopened.DeleteAccount(addr, "gone")
+	if have := reopened.GetAccount(addr, "gone"); len(have) != 0 {
+		t.Errorf("deleted asset record still visible: %x", have)
+	}
+	reopened.SetState(addr, key, common.Hash{})
+	next, err := reopened.Commit(false)
+	if err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	state, _ = New(next, db)
+	if have := state.GetAccount(addr, "gone"); len(have) != 0 {
+		t.Errorf("deleted asset record persisted: %x", have)
+	}
+	if have := state.GetState(addr, key); have != (common.Hash{}) {
+		t.Errorf("cleared storage persisted: %x", have)
+	}
+	// the old root is still readable
+	state, _ = New(root, db)
+	if have := state.GetAccount(addr, "gone"); !bytes.Equal(have, []byte{0x01}) {
+		t.Errorf("old root asset record mismatch: have %x", have)
+	}
+}
+
+func TestCommitMissingTrie(t *testing.T) {
+	db := memdb.NewMemDatabase()
+	addr := common.BytesToAddress([]byte("contract"))
+	key := common.BytesToHash([]byte("slot"))
+
+	state, _ := New(common.Hash{}, db)
+	state.SetState(addr, key, common.BytesToHash([]byte{1}))
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	// the account trie root is loaded, the storage trie is gone
+	reopened, err := New(root, db)
+	if err != nil {
+		t.Fatalf("can't reopen state: %v", err)
+	}
+	for _, k := range db.Keys() {
+		db.Delete(k)
+	}
+	reopened.SetState(addr, common.BytesToHash([]byte("other")), common.BytesToHash([]byte{2}))
+	if _, err := reopened.Commit(false); err == nil {
+		t.Fatal("commit on top of a missing storage trie succeeded")
+	}
+	if db.Len() != 0 {
+		t.Errorf("failed commit wrote %d records", db.Len())
+	}
+}
+
+func TestForEachStorage(t *testing.T) {
+	db := memdb.NewMemDatabase()
+	addr := common.BytesToAddress([]byte("contract"))
+	one, two, three := common.BytesToHash([]byte{1}), common.BytesToHash([]byte{2}), common.BytesToHash([]byte{3})
+
+	state, _ := New(common.Hash{}, db)
+	state.SetState(addr, one, one)
+	state.SetState(addr, two, two)
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	// mix committed slots with cached changes
+	state, _ = New(root, db)
+	state.SetState(addr, one, three)
+	state.SetState(addr, three, three)
+	state.SetState(addr, two, common.Hash{})
+
+	have := make(map[common.Hash]common.Hash)
+	state.ForEachStorage(addr, func(key, value common.Hash) bool {
+		have[key] = value
+		return true
+	})
+	if len(have) != 2 || have[one] != three || have[three] != three {
+		t.Errorf("storage mismatch: have %x", have)
+	}
+}
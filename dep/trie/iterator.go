@@ -0,0 +1,85 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+// Iterator is a key-value trie iterator that traverses the leaves of a trie
+// in ascending key order, loading the nodes from the database as needed.
+type Iterator struct {
+	trie  *Trie
+	stack []iteratorEntry
+
+	Key   []byte // Current data key on which the iterator is positioned on
+	Value []byte // Current data value on which the iterator is positioned on
+	Err   error
+}
+
+// iteratorEntry is a node left to visit together with the hex path leading
+// to it.
+type iteratorEntry struct {
+	node node
+	path []byte
+}
+
+// NewIterator creates a new key-value iterator over the leaves of t.
+func NewIterator(t *Trie) *Iterator {
+	it := &Iterator{trie: t}
+	if t.root != nil {
+		it.stack = []iteratorEntry{{node: t.root}}
+	}
+	return it
+}
+
+// Next moves the iterator forward one key-value entry.
+func (it *Iterator) Next() bool {
+	for len(it.stack) > 0 {
+		e := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+
+		switch n := e.node.(type) {
+		case hashNode:
+			resolved, err := it.trie.resolveHash(n, e.path)
+			if err != nil {
+				it.Err, it.stack = err, nil
+				return false
+			}
+			it.stack = append(it.stack, iteratorEntry{resolved, e.path})
+		case *shortNode:
+			it.stack = append(it.stack, iteratorEntry{n.Val, concat(e.path, n.Key...)})
+		case *fullNode:
+			// Push the children backwards, the value of the node itself
+			// sorts before all of them.
+			for i := 15; i >= 0; i-- {
+				if n.Children[i] != nil {
+					it.stack = append(it.stack, iteratorEntry{n.Children[i], concat(e.path, byte(i))})
+				}
+			}
+			if n.Children[16] != nil {
+				it.stack = append(it.stack, iteratorEntry{n.Children[16], concat(e.path, 16)})
+			}
+		case valueNode:
+			it.Key, it.Value = hexToKeybytes(e.path), n
+			return true
+		}
+	}
+	return false
+}
+
+// NewIterator creates a new key-value iterator over the leaves of the secure
+// trie, the keys it returns are the hashed ones.
+func (t *SecureTrie) NewIterator() *Iterator {
+	return NewIterator(&t.trie)
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/crypto"
+	"github.com/vm-project/dep/memdb"
+)
+
+// secureKeyPrefix is the database key prefix of the preimages of hashed keys.
+var secureKeyPrefix = []byte("secure-key-")
+
+// SecureTrie wraps a trie with key hashing. In a secure trie, all
+// access operations hash the key using keccak256. This prevents
+// calling code from creating long chains of nodes that
+// increase the access time.
+//
+// The preimages of the hashed keys are kept in memory until Commit writes
+// them to the database, both can be queried with GetKey.
+//
+// SecureTrie is not safe for concurrent use.
+type SecureTrie struct {
+	trie      Trie
+	preimages map[string][]byte // Preimages of the keys updated since the last commit
+}
+
+// NewSecure creates a trie with an existing root node from db.
+//
+// If root is the zero hash or the sha3 hash of an empty string, the
+// trie is initially empty. Otherwise, New will panic if db is nil
+// and returns MissingNodeError if the root node cannot be found.
+func NewSecure(root common.Hash, db memdb.Database) (*SecureTrie, error) {
+	trie, err := New(root, db)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureTrie{trie: *trie}, nil
+}
+
+// Get returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+func (t *SecureTrie) Get(key []byte) []byte {
+	res, err := t.TryGet(key)
+	if err != nil {
+		panic(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+	return res
+}
+
+// TryGet returns the value for key stored in the trie.
+// The value bytes must not be modified by the caller.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *SecureTrie) TryGet(key []byte) ([]byte, error) {
+	return t.trie.TryGet(crypto.Keccak256(key))
+}
+
+// Update associates key with value in the trie. Subsequent calls to
+// Get will return value. If value has length zero, any existing value
+// is deleted from the trie and calls to Get will return nil.
+//
+// The value bytes must not be modified by the caller while they are
+// stored in the trie.
+func (t *SecureTrie) Update(key, value []byte) {
+	if err := t.TryUpdate(key, value); err != nil {
+		panic(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryUpdate associates key with value in the trie. Subsequent calls to
+// Get will return value. If value has length zero, any existing value
+// is deleted from the trie and calls to Get will return nil.
+//
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *SecureTrie) TryUpdate(key, value []byte) error {
+	hk := crypto.Keccak256(key)
+	if err := t.trie.TryUpdate(hk, value); err != nil {
+		return err
+	}
+	if t.preimages == nil {
+		t.preimages = make(map[string][]byte)
+	}
+	t.preimages[string(hk)] = common.CopyBytes(key)
+	return nil
+}
+
+// Delete removes any existing value for key from the trie.
+func (t *SecureTrie) Delete(key []byte) {
+	if err := t.TryDelete(key); err != nil {
+		panic(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+}
+
+// TryDelete removes any existing value for key from the trie.
+// If a node was not found in the database, a MissingNodeError is returned.
+func (t *SecureTrie) TryDelete(key []byte) error {
+	hk := crypto.Keccak256(key)
+	delete(t.preimages, string(hk))
+	return t.trie.TryDelete(hk)
+}
+
+// GetKey returns the preimage of a hashed key that was
+// previously used to store a value.
+func (t *SecureTrie) GetKey(shaKey []byte) []byte {
+	if key, ok := t.preimages[string(shaKey)]; ok {
+		return key
+	}
+	if t.trie.db == nil {
+		return nil
+	}
+	key, _ := t.trie.db.Get(secureKey(shaKey))
+	return key
+}
+
+// Hash returns the root hash of SecureTrie. It does not write to the
+// database and can be used even if the trie doesn't have one.
+func (t *SecureTrie) Hash() common.Hash {
+	return t.trie.Hash()
+}
+
+// Commit writes all nodes and the secure hash pre-images to db and
+// returns the root hash.
+func (t *SecureTrie) Commit(db memdb.Putter) (root common.Hash, err error) {
+	for hk, key := range t.preimages {
+		if err := db.Put(secureKey([]byte(hk)), key); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	t.preimages = nil
+	return t.trie.Commit(db)
+}
+
+func secureKey(key []byte) []byte {
+	return append(append([]byte{}, secureKeyPrefix...), key...)
+}
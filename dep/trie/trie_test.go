@@ -0,0 +1,152 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/memdb"
+)
+
+func TestEmptyTrie(t *testing.T) {
+	var trie Trie
+	if res := trie.Hash(); res != EmptyRoot {
+		t.Errorf("expected %x got %x", EmptyRoot, res)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	trie := new(Trie)
+	trie.Update([]byte("doe"), []byte("reindeer"))
+	trie.Update([]byte("dog"), []byte("puppy"))
+	trie.Update([]byte("dogglesworth"), []byte("cat"))
+
+	exp := common.HexToHash("8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3")
+	if root := trie.Hash(); root != exp {
+		t.Errorf("exp %x got %x", exp, root)
+	}
+
+	trie = new(Trie)
+	trie.Update([]byte("A"), bytes.Repeat([]byte("a"), 50))
+
+	exp = common.HexToHash("d23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab")
+	root, err := trie.Commit(memdb.NewMemDatabase())
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if root != exp {
+		t.Errorf("exp %x got %x", exp, root)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	trie := new(Trie)
+	vals := []struct{ k, v string }{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"shaman", "horse"},
+		{"doge", "coin"},
+		{"ether", ""},
+		{"dog", "puppy"},
+		{"shaman", ""},
+	}
+	for _, val := range vals {
+		if val.v != "" {
+			trie.Update([]byte(val.k), []byte(val.v))
+		} else {
+			trie.Delete([]byte(val.k))
+		}
+	}
+
+	hash := trie.Hash()
+	exp := common.HexToHash("5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84")
+	if hash != exp {
+		t.Errorf("expected %x got %x", exp, hash)
+	}
+	if v := trie.Get([]byte("ether")); v != nil {
+		t.Errorf("deleted key still present: %q", v)
+	}
+}
+
+func TestCommitReopen(t *testing.T) {
+	db := memdb.NewMemDatabase()
+	trie, _ := NewSecure(common.Hash{}, db)
+	for i := byte(0); i < 100; i++ {
+		trie.Update([]byte{i}, bytes.Repeat([]byte{i + 1}, int(i)+1))
+	}
+	root, err := trie.Commit(db)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if _, err := NewSecure(common.HexToHash("beef"), db); err == nil {
+		t.Fatal("opening a missing root succeeded")
+	} else if _, ok := err.(*MissingNodeError); !ok {
+		t.Fatalf("error type mismatch: %T", err)
+	}
+
+	trie, err = NewSecure(root, db)
+	if err != nil {
+		t.Fatalf("can't reopen trie: %v", err)
+	}
+	for i := byte(0); i < 100; i++ {
+		if v := trie.Get([]byte{i}); !bytes.Equal(v, bytes.Repeat([]byte{i + 1}, int(i)+1)) {
+			t.Fatalf("value %d mismatch: have %x", i, v)
+		}
+	}
+	hk := common.HexToHash("bc36789e7a1e281436464229828f817d6612f7b477d66591ff96a9e064bcc98a") // keccak256(0x00)
+	if key := trie.GetKey(hk[:]); !bytes.Equal(key, []byte{0}) {
+		t.Errorf("preimage mismatch: have %x", key)
+	}
+	trie.Delete([]byte{7})
+	trie.Update([]byte{8}, nil)
+	if v := trie.Get([]byte{7}); v != nil {
+		t.Errorf("deleted value still present: %x", v)
+	}
+	if trie.Hash() == root {
+		t.Error("root unchanged after deletes")
+	}
+}
+
+func TestIterator(t *testing.T) {
+	db := memdb.NewMemDatabase()
+	trie, _ := New(common.Hash{}, db)
+	vals := map[string]string{
+		"do": "verb", "ether": "wookiedoo", "horse": "stallion", "shaman": "horse",
+		"doge": "coin", "dog": "puppy", "somethingveryoddindeedthis is": "myothernodedata",
+	}
+	for k, v := range vals {
+		trie.Update([]byte(k), []byte(v))
+	}
+	root, _ := trie.Commit(db)
+	trie, _ = New(root, db)
+
+	var keys []string
+	for it := NewIterator(trie); it.Next(); {
+		if vals[string(it.Key)] != string(it.Value) {
+			t.Errorf("value mismatch for %q: %q", it.Key, it.Value)
+		}
+		keys = append(keys, string(it.Key))
+	}
+	want := []string{"do", "dog", "doge", "ether", "horse", "shaman", "somethingveryoddindeedthis is"}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("key order mismatch:\nhave %q\nwant %q", keys, want)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 The zipper Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/vm-project/common"
+)
+
+// decodeHex decodes a 0x prefixed hex string of exactly size bytes, typ
+// names the decoded type in errors.
+func decodeHex(typ, input string, size int) ([]byte, error) {
+	if len(input) < 2 || input[0] != '0' || (input[1] != 'x' && input[1] != 'X') {
+		return nil, fmt.Errorf("hex string without 0x prefix for %s", typ)
+	}
+	dec, err := hex.DecodeString(input[2:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex string for %s: %v", typ, err)
+	}
+	if len(dec) != size {
+		return nil, fmt.Errorf("hex string has length %d, want %d for %s", len(dec), size, typ)
+	}
+	return dec, nil
+}
+
+func decodeAddress(input string) (common.Address, error) {
+	dec, err := decodeHex("common.Address", input, common.AddressLength)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(dec), nil
+}
+
+func decodeHash(input string) (common.Hash, error) {
+	dec, err := decodeHex("common.Hash", input, common.HashLength)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(dec), nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"github.com/vm-project/common"
+)
+
+// InternalTx is an asset movement made by contract code while executing a
+// transaction: a value carrying call or creation, a selfdestruct, or the
+// issuance and minting of an asset. Unlike logs they are not part of the
+// consensus encoding of a receipt.
+type InternalTx struct {
+	AssetAddr common.Address `json:"asset"`
+	// From is empty for the issuance or minting of an asset
+	From   common.Address `json:"from"`
+	To     common.Address `json:"to"`
+	Amount *big.Int       `json:"amount"`
+	// call depth of the contract that moved the asset
+	Depth int `json:"depth"`
+	// name of the opcode that moved the asset
+	Op string `json:"op"`
+	// Mint is true if the amount was newly created rather than transferred
+	Mint bool `json:"mint"`
+
+	// Derived fields, filled in by the state like the ones of Log.
+	TxHash  common.Hash `json:"transactionHash"`
+	TxIndex uint        `json:"transactionIndex"`
+	Index   uint        `json:"index"`
+}
+
+// internalTxJSON is the JSON form of InternalTx, hashes and addresses are
+// 0x prefixed hex.
+type internalTxJSON struct {
+	AssetAddr *string  `json:"asset"`
+	From      *string  `json:"from"`
+	To        *string  `json:"to"`
+	Amount    *big.Int `json:"amount"`
+	Depth     int      `json:"depth"`
+	Op        string   `json:"op"`
+	Mint      bool     `json:"mint"`
+	TxHash    *string  `json:"transactionHash"`
+	TxIndex   uint     `json:"transactionIndex"`
+	Index     uint     `json:"index"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (t InternalTx) MarshalJSON() ([]byte, error) {
+	assetAddr := common.ToHex(t.AssetAddr[:])
+	from := common.ToHex(t.From[:])
+	to := common.ToHex(t.To[:])
+	txHash := common.ToHex(t.TxHash[:])
+	return json.Marshal(&internalTxJSON{
+		AssetAddr: &assetAddr,
+		From:      &from,
+		To:        &to,
+		Amount:    t.Amount,
+		Depth:     t.Depth,
+		Op:        t.Op,
+		Mint:      t.Mint,
+		TxHash:    &txHash,
+		TxIndex:   t.TxIndex,
+		Index:     t.Index,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *InternalTx) UnmarshalJSON(input []byte) error {
+	var dec internalTxJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.AssetAddr == nil || dec.From == nil || dec.To == nil {
+		return errors.New("missing required field 'asset', 'from' or 'to' for InternalTx")
+	}
+	if dec.Amount == nil {
+		return errors.New("missing required field 'amount' for InternalTx")
+	}
+	var err error
+	if t.AssetAddr, err = decodeAddress(*dec.AssetAddr); err != nil {
+		return err
+	}
+	if t.From, err = decodeAddress(*dec.From); err != nil {
+		return err
+	}
+	if t.To, err = decodeAddress(*dec.To); err != nil {
+		return err
+	}
+	if dec.TxHash != nil {
+		if t.TxHash, err = decodeHash(*dec.TxHash); err != nil {
+			return err
+		}
+	}
+	t.Amount = dec.Amount
+	t.Depth, t.Op, t.Mint = dec.Depth, dec.Op, dec.Mint
+	t.TxIndex, t.Index = dec.TxIndex, dec.Index
+	return nil
+}
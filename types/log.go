@@ -18,12 +18,13 @@
 package types
 
 import (
+	"encoding/json"
+	"errors"
+
 	"github.com/vm-project/common"
 	"github.com/vm-project/utils/rlp"
 )
 
-//go:generate gencodec -type Log -field-override logMarshaling -out gen_log_json.go
-
 // Log represents a contract log event. These events are generated by the LOG opcode and
 // stored/indexed by the node.
 type Log struct {
@@ -61,4 +62,101 @@ func (l *Log) EncodeRLP() ([]byte, error) {
 // DecodeRLP implements rlp.Decoder
 func (l *Log) DecodeRLP(data []byte) error {
 	return rlp.DecodeBytes(data, l)
-}
\ No newline at end of file
+}
+
+// logJSON is the JSON form of Log, hashes and addresses are 0x prefixed hex.
+type logJSON struct {
+	Address     *string  `json:"address"`
+	Topics      []string `json:"topics"`
+	Data        *[]byte  `json:"data"`
+	BlockNumber *uint64  `json:"blockNumber"`
+	TxHash      *string  `json:"transactionHash"`
+	TxIndex     *uint    `json:"transactionIndex"`
+	BlockHash   *string  `json:"blockHash"`
+	Index       *uint    `json:"logIndex"`
+	Removed     *bool    `json:"removed"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (l Log) MarshalJSON() ([]byte, error) {
+	var enc logJSON
+	address := common.ToHex(l.Address[:])
+	enc.Address = &address
+	enc.Topics = make([]string, len(l.Topics))
+	for i, topic := range l.Topics {
+		enc.Topics[i] = common.ToHex(topic[:])
+	}
+	enc.Data = &l.Data
+	enc.BlockNumber = &l.BlockNumber
+	txHash := common.ToHex(l.TxHash[:])
+	enc.TxHash = &txHash
+	enc.TxIndex = &l.TxIndex
+	blockHash := common.ToHex(l.BlockHash[:])
+	enc.BlockHash = &blockHash
+	enc.Index = &l.Index
+	enc.Removed = &l.Removed
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *Log) UnmarshalJSON(input []byte) error {
+	var dec logJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Address == nil {
+		return errors.New("missing required field 'address' for Log")
+	}
+	address, err := decodeAddress(*dec.Address)
+	if err != nil {
+		return err
+	}
+	if dec.Topics == nil {
+		return errors.New("missing required field 'topics' for Log")
+	}
+	topics := make([]common.Hash, len(dec.Topics))
+	for i, topic := range dec.Topics {
+		if topics[i], err = decodeHash(topic); err != nil {
+			return err
+		}
+	}
+	if dec.Data == nil {
+		return errors.New("missing required field 'data' for Log")
+	}
+	if dec.TxHash == nil {
+		return errors.New("missing required field 'transactionHash' for Log")
+	}
+	txHash, err := decodeHash(*dec.TxHash)
+	if err != nil {
+		return err
+	}
+	if dec.TxIndex == nil {
+		return errors.New("missing required field 'transactionIndex' for Log")
+	}
+	if dec.Index == nil {
+		return errors.New("missing required field 'logIndex' for Log")
+	}
+	var blockHash common.Hash
+	if dec.BlockHash != nil {
+		if blockHash, err = decodeHash(*dec.BlockHash); err != nil {
+			return err
+		}
+	}
+
+	l.Address = address
+	l.Topics = topics
+	l.Data = *dec.Data
+	l.TxHash = txHash
+	l.TxIndex = *dec.TxIndex
+	l.BlockHash = blockHash
+	l.Index = *dec.Index
+	l.BlockNumber = 0
+	if dec.BlockNumber != nil {
+		l.BlockNumber = *dec.BlockNumber
+	}
+	l.Removed = false
+	if dec.Removed != nil {
+		l.Removed = *dec.Removed
+	}
+	return nil
+}
@@ -18,9 +18,10 @@ package types
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 
-	"github.com/zipper-project/z0/common"
+	"github.com/vm-project/common"
 )
 
 var unmarshalLogTests = map[string]struct {
@@ -99,7 +100,9 @@ func TestUnmarshalLog(t *testing.T) {
 		err := json.Unmarshal([]byte(test.input), &log)
 		checkError(t, name, err, test.wantError)
 		if test.wantError == nil && err == nil {
-			common.AssertEquals(t, log, test.want)
+			if !reflect.DeepEqual(log, test.want) {
+				t.Errorf("test %q:\nGOT %v\nWANT %v", name, log, test.want)
+			}
 		}
 	}
 }
@@ -0,0 +1,250 @@
+// Copyright 2018 The zipper Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/utils/rlp"
+)
+
+var (
+	receiptStatusFailedRLP     = []byte{}
+	receiptStatusSuccessfulRLP = []byte{0x01}
+)
+
+const (
+	// ReceiptStatusFailed is the status code of a transaction if execution failed.
+	ReceiptStatusFailed = uint64(0)
+
+	// ReceiptStatusSuccessful is the status code of a transaction if execution succeeded.
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// Receipt represents the results of a transaction.
+type Receipt struct {
+	// Consensus fields
+	PostState         []byte `json:"root"`
+	Status            uint64 `json:"status"`
+	CumulativeGasUsed uint64 `json:"cumulativeGasUsed"`
+	Bloom             Bloom  `json:"logsBloom"`
+	Logs              []*Log `json:"logs"`
+
+	// Implementation fields (don't reorder!)
+	TxHash          common.Hash    `json:"transactionHash"`
+	ContractAddress common.Address `json:"contractAddress"`
+	GasUsed         uint64         `json:"gasUsed"`
+	// asset movements made by contract code, not part of consensus
+	Internal []*InternalTx `json:"internal"`
+}
+
+// receiptRLP is the consensus encoding of a receipt.
+type receiptRLP struct {
+	PostStateOrStatus []byte
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	Logs              []*logRLP
+}
+
+// logRLP holds the consensus fields of a log, the derived ones are not
+// part of the receipt encoding.
+type logRLP struct {
+	Address common.Address
+	Topics  []common.Hash
+	Data    []byte
+}
+
+// NewReceipt creates a barebone transaction receipt, copying the init fields.
+func NewReceipt(root []byte, failed bool, cumulativeGasUsed uint64) *Receipt {
+	r := &Receipt{PostState: common.CopyBytes(root), CumulativeGasUsed: cumulativeGasUsed}
+	if failed {
+		r.Status = ReceiptStatusFailed
+	} else {
+		r.Status = ReceiptStatusSuccessful
+	}
+	return r
+}
+
+// EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
+// into an RLP stream. If no post state is present, the status is encoded instead.
+func (r *Receipt) EncodeRLP(w io.Writer) error {
+	logs := make([]*logRLP, len(r.Logs))
+	for i, log := range r.Logs {
+		logs[i] = &logRLP{Address: log.Address, Topics: log.Topics, Data: log.Data}
+	}
+	return rlp.Encode(w, &receiptRLP{r.statusEncoding(), r.CumulativeGasUsed, r.Bloom, logs})
+}
+
+// DecodeRLP implements rlp.Decoder, and loads the consensus fields of a receipt
+// from an RLP stream.
+func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
+	var dec receiptRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	if err := r.setStatus(dec.PostStateOrStatus); err != nil {
+		return err
+	}
+	r.CumulativeGasUsed, r.Bloom = dec.CumulativeGasUsed, dec.Bloom
+	r.Logs = make([]*Log, len(dec.Logs))
+	for i, log := range dec.Logs {
+		r.Logs[i] = &Log{Address: log.Address, Topics: log.Topics, Data: log.Data}
+	}
+	return nil
+}
+
+func (r *Receipt) setStatus(postStateOrStatus []byte) error {
+	switch {
+	case bytes.Equal(postStateOrStatus, receiptStatusSuccessfulRLP):
+		r.Status = ReceiptStatusSuccessful
+	case bytes.Equal(postStateOrStatus, receiptStatusFailedRLP):
+		r.Status = ReceiptStatusFailed
+	case len(postStateOrStatus) == len(common.Hash{}):
+		r.PostState = postStateOrStatus
+	default:
+		return fmt.Errorf("invalid receipt status %x", postStateOrStatus)
+	}
+	return nil
+}
+
+func (r *Receipt) statusEncoding() []byte {
+	if len(r.PostState) == 0 {
+		if r.Status == ReceiptStatusFailed {
+			return receiptStatusFailedRLP
+		}
+		return receiptStatusSuccessfulRLP
+	}
+	return r.PostState
+}
+
+// receiptJSON is the JSON form of Receipt, the post state, hashes and
+// addresses are 0x prefixed hex.
+type receiptJSON struct {
+	PostState         *string       `json:"root"`
+	Status            *uint64       `json:"status"`
+	CumulativeGasUsed *uint64       `json:"cumulativeGasUsed"`
+	Bloom             *Bloom        `json:"logsBloom"`
+	Logs              []*Log        `json:"logs"`
+	TxHash            *string       `json:"transactionHash"`
+	ContractAddress   *string       `json:"contractAddress"`
+	GasUsed           *uint64       `json:"gasUsed"`
+	Internal          []*InternalTx `json:"internal"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (r Receipt) MarshalJSON() ([]byte, error) {
+	var postState *string
+	if len(r.PostState) > 0 {
+		root := common.ToHex(r.PostState)
+		postState = &root
+	}
+	txHash := common.ToHex(r.TxHash[:])
+	contractAddress := common.ToHex(r.ContractAddress[:])
+	return json.Marshal(&receiptJSON{
+		PostState:         postState,
+		Status:            &r.Status,
+		CumulativeGasUsed: &r.CumulativeGasUsed,
+		Bloom:             &r.Bloom,
+		Logs:              r.Logs,
+		TxHash:            &txHash,
+		ContractAddress:   &contractAddress,
+		GasUsed:           &r.GasUsed,
+		Internal:          r.Internal,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (r *Receipt) UnmarshalJSON(input []byte) error {
+	var dec receiptJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	var postState []byte
+	if dec.PostState != nil {
+		var err error
+		if postState, err = decodeHex("root", *dec.PostState, common.HashLength); err != nil {
+			return err
+		}
+	}
+	if dec.CumulativeGasUsed == nil {
+		return errors.New("missing required field 'cumulativeGasUsed' for Receipt")
+	}
+	if dec.Bloom == nil {
+		return errors.New("missing required field 'logsBloom' for Receipt")
+	}
+	if dec.Logs == nil {
+		return errors.New("missing required field 'logs' for Receipt")
+	}
+	if dec.TxHash == nil {
+		return errors.New("missing required field 'transactionHash' for Receipt")
+	}
+	txHash, err := decodeHash(*dec.TxHash)
+	if err != nil {
+		return err
+	}
+	var contractAddress common.Address
+	if dec.ContractAddress != nil {
+		if contractAddress, err = decodeAddress(*dec.ContractAddress); err != nil {
+			return err
+		}
+	}
+	if dec.GasUsed == nil {
+		return errors.New("missing required field 'gasUsed' for Receipt")
+	}
+
+	r.PostState = postState
+	r.Status = ReceiptStatusFailed
+	if dec.Status != nil {
+		r.Status = *dec.Status
+	}
+	r.CumulativeGasUsed = *dec.CumulativeGasUsed
+	r.Bloom = *dec.Bloom
+	r.Logs = dec.Logs
+	r.TxHash = txHash
+	r.ContractAddress = contractAddress
+	r.GasUsed = *dec.GasUsed
+	r.Internal = dec.Internal
+	return nil
+}
+
+// String implements the fmt.Stringer interface.
+func (r *Receipt) String() string {
+	if len(r.PostState) == 0 {
+		return fmt.Sprintf("receipt{status=%d cgas=%v bloom=%x logs=%v}", r.Status, r.CumulativeGasUsed, r.Bloom, r.Logs)
+	}
+	return fmt.Sprintf("receipt{med=%x cgas=%v bloom=%x logs=%v}", r.PostState, r.CumulativeGasUsed, r.Bloom, r.Logs)
+}
+
+// Receipts is a list of receipts, one per executed message.
+type Receipts []*Receipt
+
+// Len returns the number of receipts in this list.
+func (r Receipts) Len() int { return len(r) }
+
+// GetRlp returns the RLP encoding of one receipt from the list.
+func (r Receipts) GetRlp(i int) []byte {
+	bytes, err := rlp.EncodeToBytes(r[i])
+	if err != nil {
+		panic(err)
+	}
+	return bytes
+}
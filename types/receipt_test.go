@@ -0,0 +1,124 @@
+// Copyright 2018 The zipper Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/utils/rlp"
+)
+
+func testReceipt() *Receipt {
+	receipt := NewReceipt(nil, false, 42000)
+	receipt.Logs = []*Log{{
+		Address: common.HexToAddress("0x11"),
+		Topics:  []common.Hash{common.HexToHash("dead"), common.HexToHash("beef")},
+		Data:    []byte{0x01, 0x02},
+	}}
+	receipt.Bloom = CreateBloom(Receipts{receipt})
+	receipt.TxHash = common.HexToHash("0x22")
+	receipt.ContractAddress = common.HexToAddress("0x33")
+	receipt.GasUsed = 21000
+	receipt.Internal = []*InternalTx{{
+		AssetAddr: common.HexToAddress("0x44"),
+		From:      common.HexToAddress("0x11"),
+		To:        common.HexToAddress("0x55"),
+		Amount:    big.NewInt(5),
+		Depth:     1,
+		Op:        "CALLEX",
+		TxHash:    receipt.TxHash,
+	}}
+	return receipt
+}
+
+func TestBloom(t *testing.T) {
+	receipt := testReceipt()
+	for _, b := range [][]byte{common.HexToAddress("0x11").Bytes(), common.HexToHash("dead").Bytes(), common.HexToHash("beef").Bytes()} {
+		if !BloomLookup(receipt.Bloom, bytesOf(b)) {
+			t.Errorf("bloom misses %x", b)
+		}
+	}
+	if BloomLookup(receipt.Bloom, bytesOf(common.HexToHash("cafe").Bytes())) {
+		t.Errorf("bloom matches absent topic")
+	}
+}
+
+type bytesOf []byte
+
+func (b bytesOf) Bytes() []byte { return b }
+
+func TestReceiptRLP(t *testing.T) {
+	for _, receipt := range []*Receipt{testReceipt(), NewReceipt(nil, true, 1), NewReceipt(common.HexToHash("0x44").Bytes(), false, 1)} {
+		enc, err := rlp.EncodeToBytes(receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := new(Receipt)
+		if err := rlp.DecodeBytes(enc, dec); err != nil {
+			t.Fatal(err)
+		}
+		// only the consensus fields survive the encoding
+		want := &Receipt{PostState: receipt.PostState, Status: receipt.Status, CumulativeGasUsed: receipt.CumulativeGasUsed, Bloom: receipt.Bloom, Logs: receipt.Logs}
+		if len(want.PostState) > 0 {
+			want.Status = ReceiptStatusFailed
+		}
+		if want.Logs == nil {
+			want.Logs = []*Log{}
+		}
+		if !reflect.DeepEqual(dec, want) {
+			t.Errorf("rlp mismatch:\nhave %v\nwant %v", dec, want)
+		}
+	}
+}
+
+func TestReceiptJSON(t *testing.T) {
+	receipt := testReceipt()
+	enc, err := json.Marshal(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := new(Receipt)
+	if err := json.Unmarshal(enc, dec); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dec, receipt) {
+		t.Errorf("json mismatch:\nhave %v\nwant %v", dec, receipt)
+	}
+
+	// the post state is hex like the hashes, not base64
+	receipt.PostState = common.HexToHash("0x66").Bytes()
+	enc, err = json.Marshal(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := `"root":"0x` + common.Bytes2Hex(receipt.PostState) + `"`; !strings.Contains(string(enc), root) {
+		t.Errorf("json misses %s: %s", root, enc)
+	}
+	dec = new(Receipt)
+	if err := json.Unmarshal(enc, dec); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec.PostState, receipt.PostState) {
+		t.Errorf("post state mismatch: have %x, want %x", dec.PostState, receipt.PostState)
+	}
+}
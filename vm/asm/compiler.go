@@ -36,6 +36,13 @@ type Compiler struct {
 
 	pc, pos int
 
+	// size is the length of the binary emitted so far, line and col the
+	// source position being compiled, they locate the instructions in the
+	// source map.
+	size      uint64
+	line, col int
+	locations []SourceLocation
+
 	debug bool
 }
 
@@ -129,6 +136,7 @@ func (c *Compiler) compileLine() error {
 	}
 
 	lvalue := c.next()
+	c.line, c.col = lvalue.lineno+1, lvalue.col+1
 	switch lvalue.typ {
 	case eof:
 		return nil
@@ -230,9 +238,26 @@ func (c *Compiler) pushBin(v interface{}) {
 	if c.debug {
 		fmt.Printf("%d: %v\n", len(c.binary), v)
 	}
+	switch v := v.(type) {
+	case vm.OpCode:
+		c.locations = append(c.locations, SourceLocation{Pc: c.size, Line: c.line, Column: c.col})
+		c.size++
+	case []byte:
+		c.size += uint64(len(v))
+	}
 	c.binary = append(c.binary, v)
 }
 
+// SourceMap returns the source locations of the instructions compiled so
+// far and the labels of the program.
+func (c *Compiler) SourceMap() *SourceMap {
+	labels := make(map[string]uint64, len(c.labels))
+	for name, pc := range c.labels {
+		labels[name] = uint64(pc)
+	}
+	return &SourceMap{Instructions: c.locations, Labels: labels}
+}
+
 // isPush returns whether the string op is either any of
 // push(N).
 func isPush(op string) bool {
@@ -0,0 +1,56 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package asm
+
+import "testing"
+
+// Tests that the source map locates every instruction at its source position
+func TestCompilerSourceMap(t *testing.T) {
+	src := "push 1\n;; comment\npush 2\n  add\nend:\njump @end\n"
+
+	compiler := NewCompiler(false)
+	compiler.Feed(Lex("test", []byte(src), false))
+	bin, errs := compiler.Compile()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if bin != "60016002015b630000000556" {
+		t.Fatalf("binary mismatch: have %s", bin)
+	}
+	want := []SourceLocation{{0, 1, 1}, {2, 3, 1}, {4, 4, 3}, {5, 5, 1}, {6, 6, 1}, {11, 6, 1}}
+	srcmap := compiler.SourceMap()
+	if len(srcmap.Instructions) != len(want) {
+		t.Fatalf("instruction count mismatch: have %v, want %v", srcmap.Instructions, want)
+	}
+	for i, loc := range want {
+		if srcmap.Instructions[i] != loc {
+			t.Errorf("instruction %d: have %v, want %v", i, srcmap.Instructions[i], loc)
+		}
+	}
+	if pc, ok := srcmap.Labels["end"]; !ok || pc != 5 || len(srcmap.Labels) != 1 {
+		t.Errorf("labels mismatch: have %v", srcmap.Labels)
+	}
+	if loc, ok := srcmap.Location(11); !ok || loc.Line != 6 {
+		t.Errorf("location of pc 11 mismatch: have %v", loc)
+	}
+	if _, ok := srcmap.Location(1); ok {
+		t.Errorf("found location inside push data")
+	}
+	if pcs := srcmap.LinePCs(6); len(pcs) != 2 || pcs[0] != 6 || pcs[1] != 11 {
+		t.Errorf("line 6 pcs mismatch: have %v", pcs)
+	}
+}
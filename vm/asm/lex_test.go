@@ -38,27 +38,38 @@ func TestLexer(t *testing.T) {
 	}{
 		{
 			input:  ";; this is a comment",
-			tokens: []token{{typ: lineStart}, {typ: eof}},
+			tokens: []token{{typ: lineStart}, {typ: eof, col: 20}},
 		},
 		{
 			input:  "0x12345678",
-			tokens: []token{{typ: lineStart}, {typ: number, text: "0x12345678"}, {typ: eof}},
+			tokens: []token{{typ: lineStart}, {typ: number, text: "0x12345678"}, {typ: eof, col: 10}},
 		},
 		{
 			input:  "0x123ggg",
-			tokens: []token{{typ: lineStart}, {typ: number, text: "0x123"}, {typ: element, text: "ggg"}, {typ: eof}},
+			tokens: []token{{typ: lineStart}, {typ: number, text: "0x123"}, {typ: element, col: 5, text: "ggg"}, {typ: eof, col: 8}},
 		},
 		{
 			input:  "12345678",
-			tokens: []token{{typ: lineStart}, {typ: number, text: "12345678"}, {typ: eof}},
+			tokens: []token{{typ: lineStart}, {typ: number, text: "12345678"}, {typ: eof, col: 8}},
 		},
 		{
 			input:  "123abc",
-			tokens: []token{{typ: lineStart}, {typ: number, text: "123"}, {typ: element, text: "abc"}, {typ: eof}},
+			tokens: []token{{typ: lineStart}, {typ: number, text: "123"}, {typ: element, col: 3, text: "abc"}, {typ: eof, col: 6}},
 		},
 		{
 			input:  "0123abc",
-			tokens: []token{{typ: lineStart}, {typ: number, text: "0123"}, {typ: element, text: "abc"}, {typ: eof}},
+			tokens: []token{{typ: lineStart}, {typ: number, text: "0123"}, {typ: element, col: 4, text: "abc"}, {typ: eof, col: 7}},
+		},
+		{
+			input: ";; comment\npush 1",
+			tokens: []token{
+				{typ: lineStart},
+				{typ: lineEnd, col: 10, text: "\n"},
+				{typ: lineStart, lineno: 1},
+				{typ: element, lineno: 1, text: "push"},
+				{typ: number, lineno: 1, col: 5, text: "1"},
+				{typ: eof, lineno: 1, col: 6},
+			},
 		},
 	}
 
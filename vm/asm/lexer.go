@@ -35,6 +35,7 @@ type stateFn func(*lexer) stateFn
 type token struct {
 	typ    tokenType
 	lineno int
+	col    int // 0-based column of the token on its line
 	text   string
 }
 
@@ -88,6 +89,7 @@ type lexer struct {
 	state  stateFn    // the current state function
 
 	lineno            int // current line number in the source file
+	lineStart         int // position the current line starts at
 	start, pos, width int // positions for lexing and returning value
 
 	debug bool // flag for triggering debug output
@@ -182,7 +184,7 @@ func (l *lexer) blob() string {
 
 // Emits a new token on to token channel for processing
 func (l *lexer) emit(t tokenType) {
-	token := token{t, l.lineno, l.blob()}
+	token := token{t, l.lineno, l.start - l.lineStart, l.blob()}
 
 	if l.debug {
 		fmt.Fprintf(os.Stderr, "%04d: (%-20v) %s\n", token.lineno, token.typ, token.text)
@@ -200,6 +202,7 @@ func lexLine(l *lexer) stateFn {
 			l.emit(lineEnd)
 			l.ignore()
 			l.lineno++
+			l.lineStart = l.pos
 
 			l.emit(lineStart)
 		case r == ';' && l.peek() == ';':
@@ -222,9 +225,12 @@ func lexLine(l *lexer) stateFn {
 }
 
 // lexComment parses the current position until the end
-// of the line and discards the text.
+// of the line and discards the text. The line end is left
+// to lexLine.
 func lexComment(l *lexer) stateFn {
-	l.acceptRunUntil('\n')
+	if l.acceptRunUntil('\n') {
+		l.backup()
+	}
 	l.ignore()
 
 	return lexLine
@@ -0,0 +1,91 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package asm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/vm"
+)
+
+// SourceLocation is the source position an instruction was compiled from.
+type SourceLocation struct {
+	Pc     uint64 `json:"pc"`
+	Line   int    `json:"line"`   // 1-based
+	Column int    `json:"column"` // 1-based
+}
+
+// SourceMap relates the instructions of a compiled program to the source
+// positions they were compiled from, ordered by pc, and lists the pc of
+// every label. The compiler only sees tokens, File is set by the caller.
+type SourceMap struct {
+	File         string            `json:"file"`
+	Instructions []SourceLocation  `json:"instructions"`
+	Labels       map[string]uint64 `json:"labels"`
+}
+
+// LoadSourceMap reads a source map written as JSON.
+func LoadSourceMap(file string) (*SourceMap, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	srcmap := new(SourceMap)
+	if err := json.Unmarshal(data, srcmap); err != nil {
+		return nil, err
+	}
+	return srcmap, nil
+}
+
+// Location returns the location of the instruction at pc, false if no
+// instruction starts at pc.
+func (m *SourceMap) Location(pc uint64) (SourceLocation, bool) {
+	i := sort.Search(len(m.Instructions), func(i int) bool { return m.Instructions[i].Pc >= pc })
+	if i < len(m.Instructions) && m.Instructions[i].Pc == pc {
+		return m.Instructions[i], true
+	}
+	return SourceLocation{}, false
+}
+
+// LinePCs returns the pcs of the instructions compiled from line.
+func (m *SourceMap) LinePCs(line int) []uint64 {
+	var pcs []uint64
+	for _, loc := range m.Instructions {
+		if loc.Line == line {
+			pcs = append(pcs, loc.Pc)
+		}
+	}
+	return pcs
+}
+
+// Resolver returns a vm.SourceResolver locating the instructions of the
+// code with the given hash, the code the map was compiled to.
+func (m *SourceMap) Resolver(codeHash common.Hash) vm.SourceResolver {
+	return func(hash common.Hash, pc uint64) (vm.SourcePos, bool) {
+		if hash != codeHash {
+			return vm.SourcePos{}, false
+		}
+		loc, ok := m.Location(pc)
+		if !ok {
+			return vm.SourcePos{}, false
+		}
+		return vm.SourcePos{File: m.File, Line: loc.Line, Column: loc.Column}, true
+	}
+}
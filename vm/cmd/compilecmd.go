@@ -17,6 +17,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -46,10 +47,19 @@ func compileCmd(ctx *cli.Context) error {
 		return err
 	}
 
-	bin, err := compiler.Compile(fn, src, debug)
+	bin, srcmap, err := compiler.CompileWithSourceMap(fn, src, debug)
 	if err != nil {
 		return err
 	}
+	if path := ctx.GlobalString(SourceMapFlag.Name); path != "" {
+		data, err := json.MarshalIndent(srcmap, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
 	fmt.Println(bin)
 	return nil
 }
@@ -24,6 +24,13 @@ import (
 )
 
 func Compile(fn string, src []byte, debug bool) (string, error) {
+	bin, _, err := CompileWithSourceMap(fn, src, debug)
+	return bin, err
+}
+
+// CompileWithSourceMap compiles like Compile and also returns the source
+// map of the binary.
+func CompileWithSourceMap(fn string, src []byte, debug bool) (string, *asm.SourceMap, error) {
 	compiler := asm.NewCompiler(debug)
 	compiler.Feed(asm.Lex(fn, src, debug))
 
@@ -33,7 +40,9 @@ func Compile(fn string, src []byte, debug bool) (string, error) {
 		for _, err := range compileErrors {
 			fmt.Printf("%s:%v\n", fn, err)
 		}
-		return "", errors.New("compiling failed")
+		return "", nil, errors.New("compiling failed")
 	}
-	return bin, nil
+	srcmap := compiler.SourceMap()
+	srcmap.File = fn
+	return bin, srcmap, nil
 }
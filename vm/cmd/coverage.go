@@ -0,0 +1,112 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/vm-project/vm"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	CoverageHTMLFlag = cli.StringFlag{
+		Name:  "html",
+		Usage: "write the annotated disassembly as HTML to the given file",
+	}
+	CoverageMinFlag = cli.Float64Flag{
+		Name:  "min",
+		Usage: "fail if less than this percentage of the instructions ran",
+	}
+	coverageCommand = cli.Command{
+		Action:    coverageCmd,
+		Name:      "coverage",
+		Usage:     "report the coverage collected by run --coverage",
+		ArgsUsage: "<file> [<file>...]",
+		Flags:     []cli.Flag{CoverageHTMLFlag, CoverageMinFlag},
+		Description: `The coverage command merges coverage files written by run --coverage
+and prints the instructions, JUMPI branches and easm lines covered, lines
+are known for code run from easm or with --sourcemap.`,
+	}
+)
+
+func coverageCmd(ctx *cli.Context) error {
+	if len(ctx.Args()) == 0 {
+		return errors.New("coverage file required")
+	}
+	coverage := vm.NewCoverage()
+	for _, path := range ctx.Args() {
+		other, err := readCoverage(path)
+		if err != nil {
+			return err
+		}
+		coverage.Merge(other)
+	}
+	if err := coverage.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if path := ctx.String(CoverageHTMLFlag.Name); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := coverage.WriteHTML(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	if min, have := ctx.Float64(CoverageMinFlag.Name), coverage.Summary().InstructionPercent(); have < min {
+		return fmt.Errorf("instruction coverage %.1f%% is below the minimum of %.1f%%", have, min)
+	}
+	return nil
+}
+
+func readCoverage(path string) (*vm.Coverage, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	coverage := vm.NewCoverage()
+	if err := json.Unmarshal(data, coverage); err != nil {
+		return nil, fmt.Errorf("invalid coverage file %s: %v", path, err)
+	}
+	return coverage, nil
+}
+
+// mergeCoverage adds coverage to the one in the file at path, the file is
+// created if it doesn't exist.
+func mergeCoverage(coverage *vm.Coverage, path string) error {
+	merged := vm.NewCoverage()
+	if _, err := os.Stat(path); err == nil {
+		if merged, err = readCoverage(path); err != nil {
+			return err
+		}
+	}
+	merged.Merge(coverage)
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
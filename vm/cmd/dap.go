@@ -0,0 +1,549 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/common/math"
+	"github.com/vm-project/dep/crypto"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/vm"
+	"github.com/vm-project/vm/asm"
+	"github.com/vm-project/vm/runtime"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	DAPListenFlag = cli.StringFlag{
+		Name:  "listen",
+		Usage: "serve a single client on this TCP address instead of stdio",
+	}
+	dapCommand = cli.Command{
+		Action: dapCmd,
+		Name:   "dap",
+		Usage:  "serve the Debug Adapter Protocol for editors",
+		Flags:  []cli.Flag{DAPListenFlag},
+		Description: `The dap command is a debug adapter, editors launch it to debug easm
+programs or VM code. It talks to the editor over stdio, or over TCP with
+--listen. The launch request takes program, code, input, prestate, gas,
+value, sender, receiver, create and stopOnEntry, like the run command
+flags.`,
+	}
+)
+
+func dapCmd(ctx *cli.Context) error {
+	if addr := ctx.String(DAPListenFlag.Name); addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "debug adapter listening on", listener.Addr())
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return newDAPSession(conn, conn).serve()
+	}
+	return newDAPSession(os.Stdin, os.Stdout).serve()
+}
+
+// Kinds of the variables references of a frame, a reference is the frame
+// id times dapVarKinds plus the kind.
+const (
+	dapVarStack = iota + 1
+	dapVarMemory
+	dapVarStorage
+	dapVarAssets
+	dapVarKinds
+)
+
+// dapThreadID is the id of the only thread, the execution.
+const dapThreadID = 1
+
+// dapSession is a debug adapter serving a single execution.
+type dapSession struct {
+	conn *dapConn
+
+	program  string // absolute path of the easm source, empty for plain code
+	srcmap   *asm.SourceMap
+	receiver common.Address
+	create   bool
+	lines    []int // lines of the source breakpoints
+
+	launch      *dapLaunchArguments
+	state       *statedb.StateDB
+	debugger    *vm.Debugger
+	breakpoints []*vm.Breakpoint
+	exec        func()
+	ret         []byte
+	err         error
+}
+
+func newDAPSession(r io.Reader, w io.Writer) *dapSession {
+	return &dapSession{conn: newDAPConn(r, w)}
+}
+
+// serve handles requests until the client disconnects.
+func (s *dapSession) serve() error {
+	for {
+		req, err := s.conn.read()
+		if err == io.EOF {
+			s.stop()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if done, err := s.handle(req); done || err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a request, done is set once the client disconnected.
+func (s *dapSession) handle(req *dapRequest) (done bool, err error) {
+	switch req.Command {
+	case "initialize":
+		return false, s.conn.respond(req, map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+		}, nil)
+	case "launch":
+		args := new(dapLaunchArguments)
+		if err := json.Unmarshal(req.Arguments, args); err != nil {
+			return false, s.conn.respond(req, nil, err)
+		}
+		if err := s.prepare(args); err != nil {
+			return false, s.conn.respond(req, nil, err)
+		}
+		if err := s.conn.respond(req, nil, nil); err != nil {
+			return false, err
+		}
+		return false, s.conn.event("initialized", nil)
+	case "setBreakpoints":
+		args := new(dapSetBreakpointsArguments)
+		if err := json.Unmarshal(req.Arguments, args); err != nil {
+			return false, s.conn.respond(req, nil, err)
+		}
+		s.lines = s.lines[:0]
+		for _, bp := range args.Breakpoints {
+			s.lines = append(s.lines, bp.Line)
+		}
+		return false, s.conn.respond(req, map[string]interface{}{"breakpoints": s.setBreakpoints()}, nil)
+	case "setExceptionBreakpoints":
+		return false, s.conn.respond(req, map[string]interface{}{"breakpoints": []dapBreakpoint{}}, nil)
+	case "configurationDone":
+		if s.debugger == nil {
+			return false, s.conn.respond(req, nil, errors.New("no program launched"))
+		}
+		if err := s.conn.respond(req, nil, nil); err != nil {
+			return false, err
+		}
+		paused := s.debugger.Start(s.exec)
+		if paused != nil && !s.launch.StopOnEntry {
+			paused = s.debugger.Continue()
+		}
+		return false, s.stopped(paused, "entry")
+	case "threads":
+		return false, s.conn.respond(req, map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": dapThreadID, "name": "main"}},
+		}, nil)
+	case "stackTrace":
+		return false, s.conn.respond(req, s.stackTrace(), nil)
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return false, s.conn.respond(req, nil, err)
+		}
+		return false, s.conn.respond(req, map[string]interface{}{"scopes": s.scopes(args.FrameID)}, nil)
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return false, s.conn.respond(req, nil, err)
+		}
+		vars, err := s.variables(args.VariablesReference)
+		return false, s.conn.respond(req, map[string]interface{}{"variables": vars}, err)
+	case "continue", "next", "stepIn", "stepOut":
+		if s.debugger == nil || s.debugger.State() == nil {
+			return false, s.conn.respond(req, nil, errors.New("execution is not paused"))
+		}
+		if err := s.conn.respond(req, map[string]interface{}{"allThreadsContinued": true}, nil); err != nil {
+			return false, err
+		}
+		var paused *vm.DebugState
+		switch req.Command {
+		case "continue":
+			paused = s.debugger.Continue()
+		case "next":
+			paused = s.stepLine(s.debugger.StepOver)
+		case "stepIn":
+			paused = s.stepLine(s.debugger.Step)
+		case "stepOut":
+			paused = s.debugger.StepOut()
+		}
+		return false, s.stopped(paused, "step")
+	case "disconnect", "terminate":
+		s.stop()
+		return req.Command == "disconnect", s.conn.respond(req, nil, nil)
+	}
+	return false, s.conn.respond(req, nil, fmt.Errorf("unsupported request %q", req.Command))
+}
+
+// prepare compiles the program and sets up the state and the execution of
+// a launch request, the execution starts on configurationDone.
+func (s *dapSession) prepare(args *dapLaunchArguments) error {
+	var code []byte
+	switch {
+	case args.Program != "":
+		path, err := filepath.Abs(args.Program)
+		if err != nil {
+			return err
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		compiler := asm.NewCompiler(false)
+		compiler.Feed(asm.Lex(path, src, false))
+		bin, errs := compiler.Compile()
+		if len(errs) > 0 {
+			return fmt.Errorf("%s:%v", path, errs[0])
+		}
+		code = common.Hex2Bytes(bin)
+		s.program, s.srcmap = path, compiler.SourceMap()
+		s.srcmap.File = path
+	case args.Code != "":
+		code = common.FromHex(args.Code)
+	default:
+		return errors.New("launch needs a program or code")
+	}
+
+	var (
+		genesis *runtime.Genesis
+		err     error
+	)
+	if args.Prestate != "" {
+		genesis = new(runtime.Genesis)
+		data, err := ioutil.ReadFile(args.Prestate)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, genesis); err != nil {
+			return fmt.Errorf("invalid prestate file: %v", err)
+		}
+		if s.state, _, err = genesis.ToState(memdb.NewMemDatabase()); err != nil {
+			return err
+		}
+	} else if s.state, err = statedb.New(common.Hash{}, memdb.NewMemDatabase()); err != nil {
+		return err
+	}
+
+	sender := common.BytesToAddress([]byte("sender"))
+	if args.Sender != "" {
+		sender = common.HexToAddress(args.Sender)
+	}
+	if !s.state.Exist(sender) {
+		s.state.CreateAccount(sender)
+	}
+	s.receiver = common.BytesToAddress([]byte("receiver"))
+	if args.Receiver != "" {
+		s.receiver = common.HexToAddress(args.Receiver)
+	}
+	value := new(big.Int)
+	if args.Value != "" {
+		var ok bool
+		if value, ok = math.ParseBig256(args.Value); !ok {
+			return fmt.Errorf("invalid value %q", args.Value)
+		}
+	}
+	gas := args.Gas
+	if gas == 0 {
+		gas = GasFlag.Value
+	}
+
+	s.debugger = vm.NewDebugger()
+	runtimeConfig := &runtime.Config{
+		Origin:      sender,
+		State:       s.state,
+		GasLimit:    gas,
+		Value:       value,
+		BlockNumber: new(big.Int),
+		EVMConfig: vm.Config{
+			Tracer: s.debugger,
+			Debug:  true,
+		},
+	}
+	if genesis != nil {
+		genesis.Configure(runtimeConfig)
+	}
+	input := common.FromHex(args.Input)
+	if args.Create {
+		// the init code runs with the input appended
+		code, input = append(code, input...), nil
+	}
+	if s.srcmap != nil {
+		runtimeConfig.EVMConfig.Source = s.srcmap.Resolver(crypto.Keccak256Hash(code))
+	}
+	s.launch, s.create = args, args.Create
+	s.exec = func() {
+		if s.create {
+			s.ret, _, _, s.err = runtime.Create(code, runtimeConfig)
+		} else {
+			s.state.SetCode(s.receiver, code)
+			s.ret, _, s.err = runtime.Call(s.receiver, input, runtimeConfig)
+		}
+	}
+	s.setBreakpoints()
+	return nil
+}
+
+// setBreakpoints replaces the breakpoints of the debugger by the ones of
+// the source lines, a line breaks before its first instruction.
+func (s *dapSession) setBreakpoints() []dapBreakpoint {
+	if s.debugger != nil {
+		for _, bp := range s.breakpoints {
+			s.debugger.RemoveBreakpoint(bp.ID)
+		}
+	}
+	s.breakpoints = s.breakpoints[:0]
+
+	result := make([]dapBreakpoint, 0, len(s.lines))
+	for _, line := range s.lines {
+		if s.debugger == nil || s.srcmap == nil {
+			result = append(result, dapBreakpoint{Line: line, Message: "no program launched"})
+			continue
+		}
+		pcs := s.srcmap.LinePCs(line)
+		if len(pcs) == 0 {
+			result = append(result, dapBreakpoint{Line: line, Message: "no instruction on this line"})
+			continue
+		}
+		bp := vm.Breakpoint{Kind: vm.BreakPC, Pc: pcs[0]}
+		if !s.create {
+			bp.Addr = s.receiver
+		}
+		added := s.debugger.AddBreakpoint(bp)
+		s.breakpoints = append(s.breakpoints, added)
+		result = append(result, dapBreakpoint{ID: added.ID, Verified: true, Line: line})
+	}
+	return result
+}
+
+// stepLine steps until the execution reaches another source line, code
+// without source is stepped by instruction.
+func (s *dapSession) stepLine(step func() *vm.DebugState) *vm.DebugState {
+	start := s.line(s.debugger.State())
+	for {
+		paused := step()
+		if paused == nil || paused.Breakpoint != nil {
+			return paused
+		}
+		if line := s.line(paused); line == 0 || line != start {
+			return paused
+		}
+	}
+}
+
+// line returns the source line of the paused instruction, 0 if it is not
+// part of the program.
+func (s *dapSession) line(paused *vm.DebugState) int {
+	if paused == nil {
+		return 0
+	}
+	frames := s.debugger.Frames()
+	if len(frames) == 0 {
+		return 0
+	}
+	return s.frameLine(frames[0].To, paused.Contract.Address(), paused.Pc)
+}
+
+func (s *dapSession) frameLine(programAddr, addr common.Address, pc uint64) int {
+	loc, _ := s.frameLocation(programAddr, addr, pc)
+	return loc.Line
+}
+
+// frameLocation returns the source location of an instruction of the
+// program, false for other code.
+func (s *dapSession) frameLocation(programAddr, addr common.Address, pc uint64) (asm.SourceLocation, bool) {
+	if s.srcmap == nil || addr != programAddr {
+		return asm.SourceLocation{}, false
+	}
+	return s.srcmap.Location(pc)
+}
+
+// stopped tells the client where the execution paused, or that it ended.
+func (s *dapSession) stopped(paused *vm.DebugState, reason string) error {
+	if paused == nil {
+		return s.terminated()
+	}
+	body := map[string]interface{}{
+		"reason":            reason,
+		"threadId":          dapThreadID,
+		"allThreadsStopped": true,
+	}
+	if paused.Breakpoint != nil {
+		body["reason"] = "breakpoint"
+		body["hitBreakpointIds"] = []int{paused.Breakpoint.ID}
+	}
+	return s.conn.event("stopped", body)
+}
+
+func (s *dapSession) terminated() error {
+	output := fmt.Sprintf("0x%x\n", s.ret)
+	exitCode := 0
+	if s.err != nil {
+		output += fmt.Sprintf(" error: %v\n", s.err)
+		exitCode = 1
+	}
+	if err := s.conn.event("output", map[string]interface{}{"category": "stdout", "output": output}); err != nil {
+		return err
+	}
+	if err := s.conn.event("exited", map[string]interface{}{"exitCode": exitCode}); err != nil {
+		return err
+	}
+	return s.conn.event("terminated", nil)
+}
+
+// stop aborts the execution if it is paused.
+func (s *dapSession) stop() {
+	if s.debugger != nil && s.debugger.State() != nil {
+		s.debugger.Stop()
+	}
+}
+
+// stackTrace lists the calls in progress, innermost first. The frame ids
+// are the call depths.
+func (s *dapSession) stackTrace() map[string]interface{} {
+	var frames []*vm.DebugFrame
+	if s.debugger != nil && s.debugger.State() != nil {
+		frames = s.debugger.Frames()
+	}
+	result := make([]dapStackFrame, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		frame := dapStackFrame{
+			ID:   i + 1,
+			Name: fmt.Sprintf("%v %s pc=%d", f.Type, f.To.Hex(), f.Pc),
+		}
+		if loc, ok := s.frameLocation(frames[0].To, f.To, f.Pc); ok {
+			frame.Source = &dapSource{Name: filepath.Base(s.program), Path: s.program}
+			frame.Line, frame.Column = loc.Line, loc.Column
+		}
+		result = append(result, frame)
+	}
+	return map[string]interface{}{"stackFrames": result, "totalFrames": len(result)}
+}
+
+// scopes returns the variable groups of a frame, the stack and memory are
+// only known for the innermost one.
+func (s *dapSession) scopes(frameID int) []dapScope {
+	ref := frameID * dapVarKinds
+	var scopes []dapScope
+	if s.debugger != nil && frameID == len(s.debugger.Frames()) {
+		scopes = append(scopes,
+			dapScope{Name: "Stack", VariablesReference: ref + dapVarStack},
+			dapScope{Name: "Memory", VariablesReference: ref + dapVarMemory},
+		)
+	}
+	return append(scopes,
+		dapScope{Name: "Storage", VariablesReference: ref + dapVarStorage},
+		dapScope{Name: "Assets", VariablesReference: ref + dapVarAssets},
+	)
+}
+
+func (s *dapSession) variables(ref int) ([]dapVariable, error) {
+	if s.debugger == nil {
+		return nil, errors.New("no program launched")
+	}
+	paused := s.debugger.State()
+	if paused == nil {
+		return nil, errors.New("execution is not paused")
+	}
+	frames := s.debugger.Frames()
+	frameID, kind := ref/dapVarKinds, ref%dapVarKinds
+	if frameID < 1 || frameID > len(frames) {
+		return nil, fmt.Errorf("unknown frame %d", frameID)
+	}
+	addr := frames[frameID-1].Context
+	if frameID == len(frames) {
+		addr = paused.Contract.Address()
+	}
+
+	vars := []dapVariable{}
+	switch kind {
+	case dapVarStack:
+		data := paused.Stack.Data()
+		for i := len(data) - 1; i >= 0; i-- {
+			vars = append(vars, dapVariable{Name: fmt.Sprint(len(data) - 1 - i), Value: fmt.Sprintf("%#x", data[i])})
+		}
+	case dapVarMemory:
+		data := paused.Memory.Data()
+		for i := 0; i < len(data); i += 32 {
+			end := i + 32
+			if end > len(data) {
+				end = len(data)
+			}
+			vars = append(vars, dapVariable{Name: fmt.Sprintf("0x%04x", i), Value: fmt.Sprintf("0x%x", data[i:end])})
+		}
+	case dapVarStorage:
+		var keys []common.Hash
+		slots := make(map[common.Hash]common.Hash)
+		s.state.ForEachStorage(addr, func(key, value common.Hash) bool {
+			keys = append(keys, key)
+			slots[key] = value
+			return true
+		})
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+		for _, key := range keys {
+			value := slots[key]
+			vars = append(vars, dapVariable{Name: common.ToHex(key[:]), Value: common.ToHex(value[:])})
+		}
+	case dapVarAssets:
+		assets, err := paused.Env.Asset.GetUserAssets(addr)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range assets {
+			name := a.AssetName
+			if name == "" {
+				name = a.AssetAddr.Hex()
+			}
+			vars = append(vars, dapVariable{Name: name, Value: a.Balance.String()})
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", ref)
+	}
+	return vars, nil
+}
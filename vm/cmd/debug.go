@@ -0,0 +1,411 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/common/math"
+	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/utils"
+	"github.com/vm-project/vm"
+	"github.com/vm-project/vm/runtime"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var debugCommand = cli.Command{
+	Action:    debugCmd,
+	Name:      "debug",
+	Usage:     "step through vm code interactively",
+	ArgsUsage: "<code>",
+	Description: `The debug command runs VM code like the run command does, pausing
+before the first instruction. Commands are read from stdin, type help for
+the list of them.`,
+}
+
+const debugHelp = `step, s                   execute one instruction, entering calls
+next, n                   execute one instruction, stepping over calls
+out, o                    run until the current call returns
+continue, c               run until a breakpoint or the end
+break pc <pc> [address]   pause before the instruction at pc
+break op <opcode>         pause before every instruction of a kind
+break storage <key>       pause before an SLOAD or SSTORE of key
+break depth <depth>       pause when a call at depth starts
+delete <id>               remove a breakpoint
+breakpoints               list the breakpoints
+where                     show the calls in progress
+stack                     show the stack, top first
+memory [offset [size]]    show memory
+storage <key> [address]   show a storage slot of the current contract
+balance <address> [asset] show an asset balance
+set stack <n> <value>     replace the n'th stack item from the top
+set memory <offset> <hex> overwrite memory
+set storage <key> <value> write a storage slot of the current contract
+set balance <address> <asset> <value>
+                          set an asset balance
+quit, q                   abort the execution
+`
+
+func debugCmd(ctx *cli.Context) error {
+	if ctx.GlobalString(CodeFileFlag.Name) == "-" {
+		return errors.New("debug reads commands from stdin, code can't be read from it")
+	}
+	var (
+		sender   = common.BytesToAddress([]byte("sender"))
+		receiver = common.BytesToAddress([]byte("receiver"))
+	)
+	state, genesis, db := loadState(ctx)
+	defer db.Close()
+	if ctx.GlobalString(SenderFlag.Name) != "" {
+		sender = common.HexToAddress(ctx.GlobalString(SenderFlag.Name))
+	}
+	if !state.Exist(sender) {
+		state.CreateAccount(sender)
+	}
+	if ctx.GlobalString(ReceiverFlag.Name) != "" {
+		receiver = common.HexToAddress(ctx.GlobalString(ReceiverFlag.Name))
+	}
+	code, srcmap, err := loadCode(ctx)
+	if err != nil {
+		return err
+	}
+	source := sourceResolver(ctx, srcmap, code)
+
+	debugger := vm.NewDebugger()
+	runtimeConfig := runtime.Config{
+		Origin:      sender,
+		State:       state,
+		GasLimit:    ctx.GlobalUint64(GasFlag.Name),
+		GasPrice:    utils.GlobalBig(ctx, PriceFlag.Name),
+		Value:       utils.GlobalBig(ctx, ValueFlag.Name),
+		BlockNumber: new(big.Int),
+		EVMConfig: vm.Config{
+			Tracer: debugger,
+			Debug:  true,
+			Source: source,
+		},
+	}
+	if genesis != nil {
+		genesis.Configure(&runtimeConfig)
+	}
+
+	var ret []byte
+	exec := func() {
+		if ctx.GlobalBool(CreateFlag.Name) {
+			input := append(code, common.Hex2Bytes(ctx.GlobalString(InputFlag.Name))...)
+			ret, _, _, err = runtime.Create(input, &runtimeConfig)
+		} else {
+			if len(code) > 0 {
+				state.SetCode(receiver, code)
+			}
+			ret, _, err = runtime.Call(receiver, common.Hex2Bytes(ctx.GlobalString(InputFlag.Name)), &runtimeConfig)
+		}
+	}
+	session := &debugSession{debugger: debugger, state: state, source: source, out: os.Stdout}
+	session.show(debugger.Start(exec))
+	session.run(os.Stdin)
+	if debugger.Aborted() {
+		return errors.New("execution aborted")
+	}
+
+	fmt.Printf("0x%x\n", ret)
+	if err != nil {
+		fmt.Printf(" error: %v\n", err)
+	}
+	return nil
+}
+
+// debugSession reads debugger commands and prints their results.
+type debugSession struct {
+	debugger *vm.Debugger
+	state    *statedb.StateDB
+	source   vm.SourceResolver
+	out      io.Writer
+}
+
+// run executes the commands read from in until the execution finished, it
+// is aborted on quit or at the end of the input. An empty line repeats the
+// previous command.
+func (s *debugSession) run(in io.Reader) {
+	var (
+		scanner = bufio.NewScanner(in)
+		last    []string
+	)
+	for s.debugger.State() != nil {
+		fmt.Fprint(s.out, "(vm) ")
+		if !scanner.Scan() {
+			s.debugger.Stop()
+			return
+		}
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			args = last
+		}
+		if len(args) == 0 {
+			continue
+		}
+		last = args
+		if args[0] == "quit" || args[0] == "q" {
+			s.debugger.Stop()
+			return
+		}
+		if err := s.exec(args); err != nil {
+			fmt.Fprintln(s.out, "error:", err)
+		}
+	}
+}
+
+func (s *debugSession) exec(args []string) error {
+	paused := s.debugger.State()
+	switch args[0] {
+	case "help", "h":
+		fmt.Fprint(s.out, debugHelp)
+	case "step", "s":
+		s.show(s.debugger.Step())
+	case "next", "n":
+		s.show(s.debugger.StepOver())
+	case "out", "o":
+		s.show(s.debugger.StepOut())
+	case "continue", "c":
+		s.show(s.debugger.Continue())
+	case "break", "b":
+		bp, err := parseBreakpoint(args[1:])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, "breakpoint", s.debugger.AddBreakpoint(bp))
+	case "delete", "d":
+		if len(args) != 2 {
+			return errors.New("usage: delete <id>")
+		}
+		id, ok := math.ParseUint64(args[1])
+		if !ok || !s.debugger.RemoveBreakpoint(int(id)) {
+			return fmt.Errorf("no breakpoint %s", args[1])
+		}
+	case "breakpoints", "bl":
+		for _, bp := range s.debugger.Breakpoints() {
+			fmt.Fprintln(s.out, bp)
+		}
+	case "where", "bt":
+		frames := s.debugger.Frames()
+		for i := len(frames) - 1; i >= 0; i-- {
+			f := frames[i]
+			fmt.Fprintf(s.out, "%d: %v %s -> %s pc=%d gas=%d\n", i+1, f.Type, f.From.Hex(), f.To.Hex(), f.Pc, f.Gas)
+		}
+	case "stack":
+		data := paused.Stack.Data()
+		for i := len(data) - 1; i >= 0; i-- {
+			fmt.Fprintf(s.out, "%d: %#x\n", len(data)-1-i, data[i])
+		}
+	case "memory", "mem":
+		return s.showMemory(paused, args[1:])
+	case "storage":
+		if len(args) < 2 {
+			return errors.New("usage: storage <key> [address]")
+		}
+		key, err := parseHash(args[1])
+		if err != nil {
+			return err
+		}
+		addr := paused.Contract.Address()
+		if len(args) > 2 {
+			addr = common.HexToAddress(args[2])
+		}
+		fmt.Fprintf(s.out, "%x\n", s.state.GetState(addr, key))
+	case "balance":
+		if len(args) < 2 {
+			return errors.New("usage: balance <address> [asset]")
+		}
+		assetAddr := paused.Env.NativeAsset
+		if len(args) > 2 {
+			assetAddr = common.HexToAddress(args[2])
+		}
+		fmt.Fprintln(s.out, balanceOf(paused.Env, common.HexToAddress(args[1]), assetAddr))
+	case "set":
+		return s.set(paused, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, type help for the list of commands", args[0])
+	}
+	return nil
+}
+
+func (s *debugSession) set(paused *vm.DebugState, args []string) error {
+	if len(args) < 3 {
+		return errors.New("usage: set stack|memory|storage|balance ...")
+	}
+	switch args[0] {
+	case "stack":
+		n, ok := math.ParseUint64(args[1])
+		if !ok {
+			return fmt.Errorf("invalid stack position %q", args[1])
+		}
+		value, ok := math.ParseBig256(args[2])
+		if !ok {
+			return fmt.Errorf("invalid value %q", args[2])
+		}
+		return paused.SetStack(int(n), value)
+	case "memory":
+		offset, ok := math.ParseUint64(args[1])
+		if !ok {
+			return fmt.Errorf("invalid memory offset %q", args[1])
+		}
+		return paused.SetMemory(offset, common.FromHex(args[2]))
+	case "storage":
+		key, err := parseHash(args[1])
+		if err != nil {
+			return err
+		}
+		value, err := parseHash(args[2])
+		if err != nil {
+			return err
+		}
+		s.state.SetState(paused.Contract.Address(), key, value)
+	case "balance":
+		if len(args) != 4 {
+			return errors.New("usage: set balance <address> <asset> <value>")
+		}
+		addr, assetAddr := common.HexToAddress(args[1]), common.HexToAddress(args[2])
+		value, ok := math.ParseBig256(args[3])
+		if !ok {
+			return fmt.Errorf("invalid value %q", args[3])
+		}
+		diff := new(big.Int).Sub(value, balanceOf(paused.Env, addr, assetAddr))
+		switch diff.Sign() {
+		case 1:
+			return paused.Env.Asset.AddBalance(addr, assetAddr, diff)
+		case -1:
+			return paused.Env.Asset.SubBalance(addr, assetAddr, diff.Neg(diff))
+		}
+	default:
+		return fmt.Errorf("can't set %q", args[0])
+	}
+	return nil
+}
+
+func (s *debugSession) showMemory(paused *vm.DebugState, args []string) error {
+	var (
+		offset uint64
+		size   = uint64(paused.Memory.Len())
+		ok     bool
+	)
+	if len(args) > 0 {
+		if offset, ok = math.ParseUint64(args[0]); !ok {
+			return fmt.Errorf("invalid memory offset %q", args[0])
+		}
+		size = 32
+	}
+	if len(args) > 1 {
+		if size, ok = math.ParseUint64(args[1]); !ok {
+			return fmt.Errorf("invalid memory size %q", args[1])
+		}
+	}
+	data := paused.Memory.Data()
+	if offset > uint64(len(data)) {
+		offset = uint64(len(data))
+	}
+	if offset+size > uint64(len(data)) {
+		size = uint64(len(data)) - offset
+	}
+	for i := offset; i < offset+size; i += 32 {
+		end := i + 32
+		if end > offset+size {
+			end = offset + size
+		}
+		fmt.Fprintf(s.out, "%04x: % x\n", i, data[i:end])
+	}
+	return nil
+}
+
+// show prints the instruction the debugger paused at.
+func (s *debugSession) show(paused *vm.DebugState) {
+	if paused == nil {
+		fmt.Fprintln(s.out, "execution finished")
+		return
+	}
+	if paused.Breakpoint != nil {
+		fmt.Fprintln(s.out, "hit breakpoint", paused.Breakpoint)
+	}
+	if s.source != nil {
+		if pos, ok := s.source(paused.Contract.CodeHash, paused.Pc); ok {
+			fmt.Fprintf(s.out, "%v pc=%d op=%v gas=%d depth=%d\n", pos, paused.Pc, paused.Op, paused.Gas, paused.Depth)
+			return
+		}
+	}
+	fmt.Fprintf(s.out, "%s pc=%d op=%v gas=%d depth=%d\n", paused.Contract.Address().Hex(), paused.Pc, paused.Op, paused.Gas, paused.Depth)
+}
+
+func parseBreakpoint(args []string) (vm.Breakpoint, error) {
+	if len(args) < 2 {
+		return vm.Breakpoint{}, errors.New("usage: break pc|op|storage|depth <value>")
+	}
+	switch args[0] {
+	case "pc":
+		pc, ok := math.ParseUint64(args[1])
+		if !ok {
+			return vm.Breakpoint{}, fmt.Errorf("invalid pc %q", args[1])
+		}
+		bp := vm.Breakpoint{Kind: vm.BreakPC, Pc: pc}
+		if len(args) > 2 {
+			bp.Addr = common.HexToAddress(args[2])
+		}
+		return bp, nil
+	case "op":
+		name := strings.ToUpper(args[1])
+		op := vm.StringToOp(name)
+		if op == vm.STOP && name != "STOP" {
+			return vm.Breakpoint{}, fmt.Errorf("unknown opcode %q", args[1])
+		}
+		return vm.Breakpoint{Kind: vm.BreakOp, Op: op}, nil
+	case "storage":
+		key, err := parseHash(args[1])
+		if err != nil {
+			return vm.Breakpoint{}, err
+		}
+		return vm.Breakpoint{Kind: vm.BreakStorage, Key: key}, nil
+	case "depth":
+		depth, ok := math.ParseUint64(args[1])
+		if !ok || depth == 0 {
+			return vm.Breakpoint{}, fmt.Errorf("invalid depth %q", args[1])
+		}
+		return vm.Breakpoint{Kind: vm.BreakDepth, Depth: int(depth)}, nil
+	}
+	return vm.Breakpoint{}, fmt.Errorf("unknown breakpoint kind %q", args[0])
+}
+
+// parseHash parses a storage key or value, given in decimal or 0x prefixed
+// hex.
+func parseHash(s string) (common.Hash, error) {
+	v, ok := math.ParseBig256(s)
+	if !ok {
+		return common.Hash{}, fmt.Errorf("invalid 256 bit value %q", s)
+	}
+	return common.BigToHash(v), nil
+}
+
+func balanceOf(env *vm.EVM, addr, assetAddr common.Address) *big.Int {
+	if balance, ok := env.Asset.GetBalance(addr, assetAddr).(*big.Int); ok {
+		return balance
+	}
+	return new(big.Int)
+}
@@ -114,6 +114,22 @@ var (
 		Name:  "json",
 		Usage: "output trace logs in machine readable format (json)",
 	}
+	CallTraceFlag = cli.BoolFlag{
+		Name:  "calltrace",
+		Usage: "output the tree of calls and creations as json",
+	}
+	CoverageFlag = cli.StringFlag{
+		Name:  "coverage",
+		Usage: "merge the instruction coverage of the execution into the given file",
+	}
+	SourceMapFlag = cli.StringFlag{
+		Name:  "sourcemap",
+		Usage: "source map file, written by compile and read by run and debug to locate the instructions of --code or --codefile",
+	}
+	GasProfileFlag = cli.StringFlag{
+		Name:  "gasprofile",
+		Usage: "write a pprof gas profile of the execution to the given file",
+	}
 	SenderFlag = cli.StringFlag{
 		Name:  "sender",
 		Usage: "The transaction origin",
@@ -130,6 +146,10 @@ var (
 		Name:  "nostack",
 		Usage: "disable stack output",
 	}
+	DataDirFlag = cli.StringFlag{
+		Name:  "datadir",
+		Usage: "directory keeping the state between runs",
+	}
 )
 
 func init() {
@@ -150,15 +170,23 @@ func init() {
 		StatDumpFlag,
 		GenesisFlag,
 		MachineFlag,
+		CallTraceFlag,
+		GasProfileFlag,
+		CoverageFlag,
+		SourceMapFlag,
 		SenderFlag,
 		ReceiverFlag,
 		DisableMemoryFlag,
 		DisableStackFlag,
+		DataDirFlag,
 	}
 	app.Commands = []cli.Command{
 		compileCommand,
 		disasmCommand,
 		runCommand,
+		debugCommand,
+		dapCommand,
+		coverageCommand,
 		//stateTestCommand,
 	}
 }
@@ -18,7 +18,7 @@ package main
 
 import (
 	"bytes"
-
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -30,11 +30,16 @@ import (
 	"gopkg.in/urfave/cli.v1"
 	"github.com/vm-project/vm"
 	"github.com/vm-project/vm/runtime"
+	"github.com/vm-project/dep/asset"
+	"github.com/vm-project/dep/filedb"
+	"github.com/vm-project/dep/memdb"
 	"github.com/vm-project/dep/statedb"
 
 	"github.com/vm-project/vm/params"
 	"github.com/vm-project/utils"
 	"github.com/vm-project/common"
+	"github.com/vm-project/dep/crypto"
+	"github.com/vm-project/vm/asm"
 	"github.com/vm-project/vm/cmd/compiler"
 )
 
@@ -48,75 +53,94 @@ var runCommand = cli.Command{
 
 // readGenesis will read the given JSON format genesis file and return
 // the initialized Genesis structure
-//func readGenesis(genesisPath string) *core.Genesis {
-//	// Make sure we have a valid genesis JSON
-//	//genesisPath := ctx.Args().First()
-//	if len(genesisPath) == 0 {
-//		utils.Fatalf("Must supply path to genesis JSON file")
-//	}
-//	file, err := os.Open(genesisPath)
-//	if err != nil {
-//		utils.Fatalf("Failed to read genesis file: %v", err)
-//	}
-//	defer file.Close()
-//
-//	genesis := new(core.Genesis)
-//	if err := json.NewDecoder(file).Decode(genesis); err != nil {
-//		utils.Fatalf("invalid genesis file: %v", err)
-//	}
-//	return genesis
-//}
-
-func runCmd(ctx *cli.Context) error {
-	//glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
-	//glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
-	//log.Root().SetHandler(glogger)
-	logconfig := &vm.LogConfig{
-		DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
-		DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
-		Debug:         ctx.GlobalBool(DebugFlag.Name),
+func readGenesis(genesisPath string) *runtime.Genesis {
+	file, err := os.Open(genesisPath)
+	if err != nil {
+		fmt.Printf("Failed to read genesis file: %v\n", err)
+		os.Exit(1)
 	}
+	defer file.Close()
 
-	var (
-		tracer      vm.Tracer
-		debugLogger *vm.StructLogger
-		state     *statedb.StateDB
-		chainConfig *params.ChainConfig
-		sender      = common.BytesToAddress([]byte("sender"))
-		receiver    = common.BytesToAddress([]byte("receiver"))
-		blockNumber uint64
-	)
-	if ctx.GlobalBool(MachineFlag.Name) {
-		//tracer = NewJSONLogger(logconfig, os.Stdout)
-	} else if ctx.GlobalBool(DebugFlag.Name) {
-		debugLogger = vm.NewStructLogger(logconfig)
-		tracer = debugLogger
-	} else {
-		//debugLogger = vm.NewStructLogger(logconfig)
+	genesis := new(runtime.Genesis)
+	if err := json.NewDecoder(file).Decode(genesis); err != nil {
+		fmt.Printf("invalid genesis file: %v\n", err)
+		os.Exit(1)
 	}
+	return genesis
+}
 
+// headRootKey is the key of the root committed by the last run in a
+// --datadir database.
+var headRootKey = []byte("head-root")
 
-	state, _ = statedb.New(common.Hash{})
-
+// openDatabase opens the --datadir database, or an in-memory one if no
+// directory is given.
+func openDatabase(ctx *cli.Context) memdb.Database {
+	dir := ctx.GlobalString(DataDirFlag.Name)
+	if dir == "" {
+		return memdb.NewMemDatabase()
+	}
+	db, err := filedb.New(dir)
+	if err != nil {
+		fmt.Printf("Failed to open data directory: %v\n", err)
+		os.Exit(1)
+	}
+	return db
+}
 
-	if ctx.GlobalString(SenderFlag.Name) != "" {
-		sender = common.HexToAddress(ctx.GlobalString(SenderFlag.Name))
+// loadState returns the state to run against and the database backing it.
+// A database the last run committed to is reopened at its root, else the
+// state is the one described by the --prestate file if given or an empty
+// one.
+func loadState(ctx *cli.Context) (*statedb.StateDB, *runtime.Genesis, memdb.Database) {
+	var (
+		db      = openDatabase(ctx)
+		genesis *runtime.Genesis
+	)
+	if path := ctx.GlobalString(GenesisFlag.Name); path != "" {
+		genesis = readGenesis(path)
 	}
-	state.CreateAccount(sender)
+	if root, err := db.Get(headRootKey); err == nil {
+		state, err := statedb.New(common.BytesToHash(root), db)
+		if err != nil {
+			fmt.Printf("Failed to open state %x: %v\n", root, err)
+			os.Exit(1)
+		}
+		return state, genesis, db
+	}
+	if genesis == nil {
+		state, _ := statedb.New(common.Hash{}, db)
+		return state, nil, db
+	}
+	state, _, err := genesis.ToState(db)
+	if err != nil {
+		fmt.Printf("Failed to load genesis: %v\n", err)
+		os.Exit(1)
+	}
+	return state, genesis, db
+}
 
-	if ctx.GlobalString(ReceiverFlag.Name) != "" {
-		receiver = common.HexToAddress(ctx.GlobalString(ReceiverFlag.Name))
+// commitState writes state to db and records its root as the one the next
+// run starts from.
+func commitState(state *statedb.StateDB, db memdb.Database) (common.Hash, error) {
+	root, err := state.Commit(true)
+	if err != nil {
+		return common.Hash{}, err
 	}
+	return root, db.Put(headRootKey, root.Bytes())
+}
 
+// loadCode returns the code given by --codefile, --code or an easm file
+// argument, in that order of precedence, and its source map: the one of the
+// easm file or the --sourcemap file, if any.
+func loadCode(ctx *cli.Context) ([]byte, *asm.SourceMap, error) {
 	var (
-		code []byte
-		ret  []byte
-		err  error
+		code    []byte
+		hexcode []byte
+		err     error
 	)
 	// The '--code' or '--codefile' flag overrides code in state
 	if ctx.GlobalString(CodeFileFlag.Name) != "" {
-		var hexcode []byte
-		var err error
 		// If - is specified, it means that code comes from stdin
 		if ctx.GlobalString(CodeFileFlag.Name) == "-" {
 			//Try reading from stdin
@@ -132,20 +156,109 @@ func runCmd(ctx *cli.Context) error {
 			}
 		}
 		code = common.Hex2Bytes(string(bytes.TrimRight(hexcode, "\n")))
-
 	} else if ctx.GlobalString(CodeFlag.Name) != "" {
 		code = common.Hex2Bytes(ctx.GlobalString(CodeFlag.Name))
 	} else if fn := ctx.Args().First(); len(fn) > 0 {
 		// EASM-file to compile
 		src, err := ioutil.ReadFile(fn)
 		if err != nil {
-			return err
+			return nil, nil, err
+		}
+		bin, srcmap, err := compiler.CompileWithSourceMap(fn, src, false)
+		if err != nil {
+			return nil, nil, err
 		}
-		bin, err := compiler.Compile(fn, src, false)
+		return common.Hex2Bytes(bin), srcmap, nil
+	}
+	if path := ctx.GlobalString(SourceMapFlag.Name); path != "" && len(code) > 0 {
+		srcmap, err := asm.LoadSourceMap(path)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		code = common.Hex2Bytes(bin)
+		return code, srcmap, nil
+	}
+	return code, nil, nil
+}
+
+// sourceResolver locates the instructions of the code run first, the init
+// code followed by the input for --create, in the source map.
+func sourceResolver(ctx *cli.Context, srcmap *asm.SourceMap, code []byte) vm.SourceResolver {
+	if srcmap == nil {
+		return nil
+	}
+	if ctx.GlobalBool(CreateFlag.Name) {
+		code = append(append([]byte{}, code...), common.Hex2Bytes(ctx.GlobalString(InputFlag.Name))...)
+	}
+	return srcmap.Resolver(crypto.Keccak256Hash(code))
+}
+
+func runCmd(ctx *cli.Context) error {
+	//glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	//glogger.Verbosity(log.Lvl(ctx.GlobalInt(VerbosityFlag.Name)))
+	//log.Root().SetHandler(glogger)
+	logconfig := &vm.LogConfig{
+		DisableMemory: ctx.GlobalBool(DisableMemoryFlag.Name),
+		DisableStack:  ctx.GlobalBool(DisableStackFlag.Name),
+		Debug:         ctx.GlobalBool(DebugFlag.Name),
+	}
+
+	var (
+		tracer      vm.Tracer
+		debugLogger *vm.StructLogger
+		callTracer  *vm.CallTracer
+		profiler    *vm.GasProfiler
+		coverage    *vm.CoverageTracer
+		state     *statedb.StateDB
+		genesis     *runtime.Genesis
+		chainConfig *params.ChainConfig
+		sender      = common.BytesToAddress([]byte("sender"))
+		receiver    = common.BytesToAddress([]byte("receiver"))
+		blockNumber uint64
+	)
+	if ctx.GlobalBool(MachineFlag.Name) {
+		tracer = vm.NewJSONLogger(logconfig, os.Stdout)
+	} else if ctx.GlobalBool(DebugFlag.Name) {
+		debugLogger = vm.NewStructLogger(logconfig)
+		tracer = debugLogger
+	} else if ctx.GlobalBool(CallTraceFlag.Name) {
+		callTracer = vm.NewCallTracer()
+		tracer = callTracer
+	} else if ctx.GlobalString(GasProfileFlag.Name) != "" {
+		profiler = vm.NewGasProfiler()
+		tracer = profiler
+	} else if ctx.GlobalString(CoverageFlag.Name) != "" {
+		coverage = vm.NewCoverageTracer()
+		tracer = coverage
+	} else {
+		//debugLogger = vm.NewStructLogger(logconfig)
+	}
+
+
+	state, genesis, db := loadState(ctx)
+	defer db.Close()
+
+	if ctx.GlobalString(SenderFlag.Name) != "" {
+		sender = common.HexToAddress(ctx.GlobalString(SenderFlag.Name))
+	}
+	if !state.Exist(sender) {
+		state.CreateAccount(sender)
+	}
+
+	if ctx.GlobalString(ReceiverFlag.Name) != "" {
+		receiver = common.HexToAddress(ctx.GlobalString(ReceiverFlag.Name))
+	}
+
+	var ret []byte
+	code, srcmap, err := loadCode(ctx)
+	if err != nil {
+		return err
+	}
+	source := sourceResolver(ctx, srcmap, code)
+	if profiler != nil {
+		profiler.Source = source
+	}
+	if coverage != nil {
+		coverage.Source = source
 	}
 
 	initialGas := ctx.GlobalUint64(GasFlag.Name)
@@ -158,7 +271,8 @@ func runCmd(ctx *cli.Context) error {
 		BlockNumber: new(big.Int).SetUint64(blockNumber),
 		EVMConfig: vm.Config{
 			Tracer: tracer,
-			Debug:  ctx.GlobalBool(DebugFlag.Name) || ctx.GlobalBool(MachineFlag.Name),
+			Debug:  tracer != nil,
+			Source: source,
 		},
 	}
 
@@ -178,6 +292,9 @@ func runCmd(ctx *cli.Context) error {
 	if chainConfig != nil {
 		runtimeConfig.ChainConfig = chainConfig
 	}
+	if genesis != nil {
+		genesis.Configure(&runtimeConfig)
+	}
 	tstart := time.Now()
 	var leftOverGas uint64
 	if ctx.GlobalBool(CreateFlag.Name) {
@@ -191,10 +308,21 @@ func runCmd(ctx *cli.Context) error {
 		ret, leftOverGas, err = runtime.Call(receiver, common.Hex2Bytes(ctx.GlobalString(InputFlag.Name)), &runtimeConfig)
 	}
 	execTime := time.Since(tstart)
+	if ctx.GlobalString(DataDirFlag.Name) != "" {
+		if _, err := commitState(state, db); err != nil {
+			fmt.Println("could not commit state: ", err)
+			os.Exit(1)
+		}
+	}
     //dump
 	if ctx.GlobalBool(DumpFlag.Name) {
-		//state.IntermediateRoot(true)
-		//fmt.Println(string(state.Dump()))
+		state.IntermediateRoot(true)
+		dump, err := asset.Dump(state)
+		if err != nil {
+			fmt.Println("could not dump state: ", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(dump))
 	}
     //
 	if memProfilePath := ctx.GlobalString(MemProfileFlag.Name); memProfilePath != "" {
@@ -231,7 +359,27 @@ Gas used:           %d
 
 `, execTime, mem.HeapObjects, mem.Alloc, mem.TotalAlloc, mem.NumGC, initialGas-leftOverGas)
 	}
-	if tracer == nil {
+	if callTracer != nil {
+		calls, err := json.MarshalIndent(callTracer.Result(), "", "    ")
+		if err != nil {
+			fmt.Println("could not encode call trace: ", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(calls))
+	}
+	if profiler != nil {
+		if err := writeGasProfile(profiler, ctx.GlobalString(GasProfileFlag.Name)); err != nil {
+			fmt.Println("could not write gas profile: ", err)
+			os.Exit(1)
+		}
+	}
+	if coverage != nil {
+		if err := mergeCoverage(coverage.Coverage(), ctx.GlobalString(CoverageFlag.Name)); err != nil {
+			fmt.Println("could not write coverage: ", err)
+			os.Exit(1)
+		}
+	}
+	if tracer == nil || callTracer != nil || profiler != nil || coverage != nil {
 		fmt.Printf("0x%x\n", ret)
 		if err != nil {
 			fmt.Printf(" error: %v\n", err)
@@ -240,3 +388,15 @@ Gas used:           %d
 
 	return nil
 }
+
+func writeGasProfile(profiler *vm.GasProfiler, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := profiler.WriteProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
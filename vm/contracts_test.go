@@ -0,0 +1,119 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+)
+
+// precompiledTest defines the input/output pairs for precompiled contract tests.
+type precompiledTest struct {
+	input, expected string
+	name            string
+}
+
+var precompiledTests = map[string][]precompiledTest{
+	"01": {{
+		input:    "38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e000000000000000000000000000000000000000000000000000000000000001b38d18acb67d25c8bb9942764b62f18e17054f66a817bd4295423adf9ed98873e789d1dd423d25f0772d2748d60f7e4b81bb14d086eba8e8e8efb6dcff8a4ae02",
+		expected: "000000000000000000000000ceaccac640adf55b2028469bd36ba501f28b699d",
+		name:     "ecrecover",
+	}},
+	"02": {{
+		input:    "",
+		expected: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		name:     "sha256-empty",
+	}},
+	"03": {{
+		input:    "",
+		expected: "0000000000000000000000009c1185a5c5e9fc54612808977ee8f548b2258d31",
+		name:     "ripemd160-empty",
+	}},
+	"04": {{
+		input:    "c0ffee",
+		expected: "c0ffee",
+		name:     "identity",
+	}},
+	"05": {{
+		input: "0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+			"0000000000000000000000000000000000000000000000000000000000000020" +
+			"03" +
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2e" +
+			"fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f",
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "modexp-fermat",
+	}},
+	"06": {{
+		input: "0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000002",
+		expected: "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd3" +
+			"15ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4",
+		name: "bn256add-double",
+	}},
+	"07": {{
+		input: "0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000002",
+		expected: "030644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd3" +
+			"15ed738c0e0a7c92e7845f96b2ae9c0a68a6a449e3538fc7ff3ebf7a5a18a2c4",
+		name: "bn256scalarmul-double",
+	}},
+	"08": {{
+		input:    "",
+		expected: "0000000000000000000000000000000000000000000000000000000000000001",
+		name:     "bn256pairing-empty",
+	}},
+}
+
+func TestPrecompiledContracts(t *testing.T) {
+	for addr, tests := range precompiledTests {
+		p := PrecompiledContractsByzantium[common.HexToAddress(addr)]
+		if p == nil {
+			t.Fatalf("missing precompiled contract at %s", addr)
+		}
+		for _, test := range tests {
+			in := common.Hex2Bytes(test.input)
+			contract := NewContract(AccountRef(common.HexToAddress("1337")),
+				nil, new(big.Int), p.RequiredGas(in))
+			t.Run(fmt.Sprintf("%s-Gas=%d", test.name, contract.Gas), func(t *testing.T) {
+				res, err := RunPrecompiledContract(p, in, contract)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(res, common.Hex2Bytes(test.expected)) {
+					t.Errorf("output mismatch: have %x, want %s", res, test.expected)
+				}
+			})
+		}
+	}
+}
+
+func TestPrecompiledOutOfGas(t *testing.T) {
+	p := PrecompiledContractsByzantium[common.BytesToAddress([]byte{1})]
+	contract := NewContract(AccountRef(common.HexToAddress("1337")),
+		nil, new(big.Int), p.RequiredGas(nil)-1)
+	if _, err := RunPrecompiledContract(p, nil, contract); err != ErrOutOfGas {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrOutOfGas)
+	}
+}
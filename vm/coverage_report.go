@@ -0,0 +1,267 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/vm-project/common"
+)
+
+// CoverageSummary totals a coverage. A JUMPI has two branches, jumping and
+// falling through. Lines are only known for code run with a source
+// resolver.
+type CoverageSummary struct {
+	Instructions, Executed    int
+	Branches, BranchesCovered int
+	Lines, LinesCovered       int
+}
+
+func (s *CoverageSummary) add(other CoverageSummary) {
+	s.Instructions += other.Instructions
+	s.Executed += other.Executed
+	s.Branches += other.Branches
+	s.BranchesCovered += other.BranchesCovered
+	s.Lines += other.Lines
+	s.LinesCovered += other.LinesCovered
+}
+
+// InstructionPercent returns the percentage of instructions executed.
+func (s CoverageSummary) InstructionPercent() float64 {
+	return percent(s.Executed, s.Instructions)
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+// coverageLine is a source line and whether one of its instructions ran.
+type coverageLine struct {
+	file    string
+	line    int
+	covered bool
+}
+
+// Summary totals the coverage of the code.
+func (cc *CodeCoverage) Summary() CoverageSummary {
+	var s CoverageSummary
+	for _, pc := range codeInstructions(cc.Code) {
+		s.Instructions++
+		if cc.Executed[pc] > 0 {
+			s.Executed++
+		}
+		if OpCode(cc.Code[pc]) == JUMPI {
+			s.Branches += 2
+			if b := cc.Branches[pc]; b != nil {
+				if b.Taken > 0 {
+					s.BranchesCovered++
+				}
+				if b.NotTaken > 0 {
+					s.BranchesCovered++
+				}
+			}
+		}
+	}
+	for _, line := range cc.lines() {
+		s.Lines++
+		if line.covered {
+			s.LinesCovered++
+		}
+	}
+	return s
+}
+
+// lines returns the source lines of the code in order.
+func (cc *CodeCoverage) lines() []coverageLine {
+	index := make(map[SourcePos]int)
+	var lines []coverageLine
+	for pc, pos := range cc.Source {
+		key := SourcePos{File: pos.File, Line: pos.Line}
+		i, ok := index[key]
+		if !ok {
+			i = len(lines)
+			index[key] = i
+			lines = append(lines, coverageLine{file: pos.File, line: pos.Line})
+		}
+		if cc.Executed[pc] > 0 {
+			lines[i].covered = true
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].file != lines[j].file {
+			return lines[i].file < lines[j].file
+		}
+		return lines[i].line < lines[j].line
+	})
+	return lines
+}
+
+// Summary totals the coverage of all codes.
+func (c *Coverage) Summary() CoverageSummary {
+	var s CoverageSummary
+	for _, cc := range c.Codes {
+		s.add(cc.Summary())
+	}
+	return s
+}
+
+// hashes returns the code hashes in order.
+func (c *Coverage) hashes() []common.Hash {
+	hashes := make([]common.Hash, 0, len(c.Codes))
+	for hash := range c.Codes {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].Big().Cmp(hashes[j].Big()) < 0 })
+	return hashes
+}
+
+// WriteText writes a summary of every code and the total, with the source
+// lines no instruction ran of.
+func (c *Coverage) WriteText(w io.Writer) error {
+	for _, hash := range c.hashes() {
+		cc := c.Codes[hash]
+		if _, err := fmt.Fprintf(w, "code %s\n", common.ToHex(hash[:])); err != nil {
+			return err
+		}
+		if err := writeSummary(w, cc.Summary()); err != nil {
+			return err
+		}
+		var missed []string
+		for _, line := range cc.lines() {
+			if !line.covered {
+				missed = append(missed, fmt.Sprintf("%s:%d", line.file, line.line))
+			}
+		}
+		if len(missed) > 0 {
+			if _, err := fmt.Fprintf(w, "  not covered  %s\n", strings.Join(missed, " ")); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := fmt.Fprintln(w, "total"); err != nil {
+		return err
+	}
+	return writeSummary(w, c.Summary())
+}
+
+func writeSummary(w io.Writer, s CoverageSummary) error {
+	_, err := fmt.Fprintf(w, "  instructions %d/%d (%.1f%%)\n  branches     %d/%d (%.1f%%)\n",
+		s.Executed, s.Instructions, s.InstructionPercent(),
+		s.BranchesCovered, s.Branches, percent(s.BranchesCovered, s.Branches))
+	if err == nil && s.Lines > 0 {
+		_, err = fmt.Fprintf(w, "  lines        %d/%d (%.1f%%)\n", s.LinesCovered, s.Lines, percent(s.LinesCovered, s.Lines))
+	}
+	return err
+}
+
+type coverageHTMLRow struct {
+	Pc          uint64
+	Count       uint64
+	Instruction string
+	Branch      string
+	Source      string
+	Class       string
+}
+
+type coverageHTMLCode struct {
+	Hash    string
+	Summary CoverageSummary
+	Rows    []coverageHTMLRow
+}
+
+var coverageHTML = template.Must(template.New("coverage").Funcs(template.FuncMap{
+	"percent": percent,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>VM coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td, th { padding: 0 1em; text-align: left; }
+tr.covered { background: #dfd; }
+tr.partial { background: #ffd; }
+tr.missed { background: #fdd; }
+</style>
+</head>
+<body>
+{{define "summary"}}<p>instructions {{.Executed}}/{{.Instructions}} ({{printf "%.1f" (percent .Executed .Instructions)}}%),
+branches {{.BranchesCovered}}/{{.Branches}} ({{printf "%.1f" (percent .BranchesCovered .Branches)}}%){{if .Lines}},
+lines {{.LinesCovered}}/{{.Lines}} ({{printf "%.1f" (percent .LinesCovered .Lines)}}%){{end}}</p>{{end}}
+<h1>Coverage</h1>
+{{template "summary" .Total}}
+{{range .Codes}}
+<h2>{{.Hash}}</h2>
+{{template "summary" .Summary}}
+<table>
+<tr><th>pc</th><th>count</th><th>instruction</th><th>branches</th><th>source</th></tr>
+{{range .Rows}}<tr class="{{.Class}}"><td>{{.Pc}}</td><td>{{.Count}}</td><td>{{.Instruction}}</td><td>{{.Branch}}</td><td>{{.Source}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the disassembly of every code annotated with how often
+// each instruction ran, the directions of each JUMPI and the source
+// positions if known.
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	data := struct {
+		Total CoverageSummary
+		Codes []coverageHTMLCode
+	}{Total: c.Summary()}
+
+	for _, hash := range c.hashes() {
+		cc := c.Codes[hash]
+		code := coverageHTMLCode{Hash: common.ToHex(hash[:]), Summary: cc.Summary()}
+		for _, pc := range codeInstructions(cc.Code) {
+			row := coverageHTMLRow{
+				Pc:          pc,
+				Count:       cc.Executed[pc],
+				Instruction: disassemble(cc.Code, pc),
+				Class:       "missed",
+			}
+			if row.Count > 0 {
+				row.Class = "covered"
+			}
+			if OpCode(cc.Code[pc]) == JUMPI {
+				b := cc.Branches[pc]
+				if b == nil {
+					b = new(BranchCoverage)
+				}
+				row.Branch = fmt.Sprintf("taken %d, not taken %d", b.Taken, b.NotTaken)
+				if row.Count > 0 && (b.Taken == 0 || b.NotTaken == 0) {
+					row.Class = "partial"
+				}
+			}
+			if pos, ok := cc.Source[pc]; ok {
+				row.Source = pos.String()
+			}
+			code.Rows = append(code.Rows, row)
+		}
+		data.Codes = append(data.Codes, code)
+	}
+	return coverageHTML.Execute(w, data)
+}
@@ -0,0 +1,363 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/vm-project/common"
+)
+
+// BreakKind selects what a Breakpoint matches.
+type BreakKind int
+
+const (
+	BreakPC      BreakKind = iota // the instruction at Pc, in Addr if set
+	BreakOp                       // every instruction Op
+	BreakStorage                  // an SLOAD or SSTORE of Key
+	BreakDepth                    // the first instruction of a frame at Depth
+)
+
+// Breakpoint stops a Debugger before an instruction runs.
+type Breakpoint struct {
+	ID    int
+	Kind  BreakKind
+	Pc    uint64
+	Addr  common.Address
+	Op    OpCode
+	Key   common.Hash
+	Depth int
+}
+
+func (bp *Breakpoint) String() string {
+	switch bp.Kind {
+	case BreakPC:
+		if bp.Addr != (common.Address{}) {
+			return fmt.Sprintf("#%d pc %d in %s", bp.ID, bp.Pc, bp.Addr.Hex())
+		}
+		return fmt.Sprintf("#%d pc %d", bp.ID, bp.Pc)
+	case BreakOp:
+		return fmt.Sprintf("#%d op %v", bp.ID, bp.Op)
+	case BreakStorage:
+		return fmt.Sprintf("#%d storage %x", bp.ID, bp.Key)
+	case BreakDepth:
+		return fmt.Sprintf("#%d depth %d", bp.ID, bp.Depth)
+	}
+	return fmt.Sprintf("#%d unknown", bp.ID)
+}
+
+// DebugFrame is a call or contract creation in progress while a Debugger
+// is paused, Pc is the instruction the frame is at. To is the account whose
+// code runs, Context the one whose storage and assets it uses, they differ
+// for DELEGATECALL and CALLCODE.
+type DebugFrame struct {
+	Type      OpCode
+	From      common.Address
+	To        common.Address
+	Context   common.Address
+	AssetAddr common.Address
+	Value     *big.Int
+	Gas       uint64
+	Pc        uint64
+}
+
+// DebugState is the VM state a Debugger paused in. The instruction at Pc
+// has not been validated or charged yet, changes made through the state
+// are seen by it. The state must not be used once the debugger resumed.
+type DebugState struct {
+	Env        *EVM
+	Pc         uint64
+	Op         OpCode
+	Gas        uint64
+	Memory     *Memory
+	Stack      *Stack
+	Contract   *Contract
+	Depth      int
+	Breakpoint *Breakpoint // breakpoint that was hit, nil after a step
+}
+
+// SetStack replaces the n'th item from the top of the stack.
+func (s *DebugState) SetStack(n int, value *big.Int) error {
+	if n < 0 || n >= s.Stack.len() {
+		return fmt.Errorf("stack item %d out of range (stack has %d items)", n, s.Stack.len())
+	}
+	s.Stack.data[s.Stack.len()-n-1] = new(big.Int).Set(value)
+	return nil
+}
+
+// SetMemory overwrites memory at offset. The memory is not expanded, the
+// data has to fit the memory used so far.
+func (s *DebugState) SetMemory(offset uint64, data []byte) error {
+	size := uint64(s.Memory.Len())
+	if uint64(len(data)) > size || offset > size-uint64(len(data)) {
+		return fmt.Errorf("memory write of %d bytes at %d out of range (memory has %d bytes)", len(data), offset, size)
+	}
+	copy(s.Memory.store[offset:], data)
+	return nil
+}
+
+type debugMode int
+
+const (
+	debugStep     debugMode = iota // pause at the next instruction
+	debugStepOver                  // pause at the next instruction not in a nested call
+	debugStepOut                   // pause once the current frame returned
+	debugContinue                  // pause at breakpoints only
+	debugDetach                    // never pause again
+)
+
+// Debugger is a Tracer that pauses the execution before instructions, on
+// every step or on breakpoints, and hands the paused state to a controller.
+// The execution runs on its own goroutine, started by Start, the controller
+// resumes it with Step, StepOver, StepOut or Continue. Each of them blocks
+// until the execution paused again and returns the new state, or nil when
+// the execution finished.
+type Debugger struct {
+	breakpoints []*Breakpoint
+	nextID      int
+
+	mode      debugMode
+	modeDepth int  // depth of the state a step over or out was issued in
+	entered   bool // no instruction ran yet in the innermost frame
+	frames    []*DebugFrame
+	current   *DebugState
+	aborted   bool
+
+	paused chan *DebugState
+	resume chan struct{}
+	done   chan struct{}
+}
+
+// NewDebugger returns a new debugger.
+func NewDebugger() *Debugger {
+	return &Debugger{
+		paused: make(chan *DebugState),
+		resume: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start runs exec on a new goroutine, exec is expected to execute code on
+// an EVM configured with the debugger as its tracer. Start returns the
+// state before the first instruction, or nil if no instruction ran.
+func (d *Debugger) Start(exec func()) *DebugState {
+	d.mode = debugStep
+	go func() {
+		defer close(d.done)
+		exec()
+	}()
+	return d.wait()
+}
+
+// Step resumes the execution up to the next instruction, entering calls.
+func (d *Debugger) Step() *DebugState {
+	return d.proceed(debugStep)
+}
+
+// StepOver resumes the execution up to the next instruction of the current
+// frame or one of its callers.
+func (d *Debugger) StepOver() *DebugState {
+	return d.proceed(debugStepOver)
+}
+
+// StepOut resumes the execution until the current frame returned.
+func (d *Debugger) StepOut() *DebugState {
+	return d.proceed(debugStepOut)
+}
+
+// Continue resumes the execution up to the next breakpoint.
+func (d *Debugger) Continue() *DebugState {
+	return d.proceed(debugContinue)
+}
+
+// Stop aborts the execution and waits for it to finish.
+func (d *Debugger) Stop() {
+	if d.current != nil {
+		d.aborted = true
+		d.current.Env.Cancel()
+	}
+	d.proceed(debugDetach)
+}
+
+// Aborted reports whether Stop aborted the execution before it finished,
+// its result and state changes are then incomplete.
+func (d *Debugger) Aborted() bool {
+	return d.aborted
+}
+
+// State returns the state the debugger is paused in, nil if the execution
+// finished or was not started.
+func (d *Debugger) State() *DebugState {
+	return d.current
+}
+
+// Frames returns the calls in progress, outermost first.
+func (d *Debugger) Frames() []*DebugFrame {
+	return d.frames
+}
+
+// AddBreakpoint registers bp and returns it with its ID assigned.
+func (d *Debugger) AddBreakpoint(bp Breakpoint) *Breakpoint {
+	d.nextID++
+	bp.ID = d.nextID
+	d.breakpoints = append(d.breakpoints, &bp)
+	return &bp
+}
+
+// RemoveBreakpoint removes the breakpoint with the given ID and reports
+// whether it existed.
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	for i, bp := range d.breakpoints {
+		if bp.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Breakpoints returns the registered breakpoints.
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+func (d *Debugger) proceed(mode debugMode) *DebugState {
+	if d.current == nil {
+		return nil
+	}
+	d.mode, d.modeDepth = mode, d.current.Depth
+	d.current = nil
+	d.resume <- struct{}{}
+	return d.wait()
+}
+
+func (d *Debugger) wait() *DebugState {
+	select {
+	case state := <-d.paused:
+		d.current = state
+	case <-d.done:
+		d.current = nil
+	}
+	return d.current
+}
+
+// CaptureStep pauses the execution if the instruction is a breakpoint or
+// the end of a step, it blocks until the controller resumes.
+func (d *Debugger) CaptureStep(env *EVM, pc uint64, op OpCode, gas uint64, memory *Memory, stack *Stack, contract *Contract, depth int) {
+	entered := d.entered
+	d.entered = false
+	if depth <= len(d.frames) {
+		d.frames[depth-1].Pc = pc
+	}
+
+	var stop bool
+	switch d.mode {
+	case debugDetach:
+		return
+	case debugStep:
+		stop = true
+	case debugStepOver:
+		stop = depth <= d.modeDepth
+	case debugStepOut:
+		stop = depth < d.modeDepth
+	}
+	bp := d.match(pc, op, stack, contract, depth, entered)
+	if !stop && bp == nil {
+		return
+	}
+	d.paused <- &DebugState{
+		Env:        env,
+		Pc:         pc,
+		Op:         op,
+		Gas:        gas,
+		Memory:     memory,
+		Stack:      stack,
+		Contract:   contract,
+		Depth:      depth,
+		Breakpoint: bp,
+	}
+	<-d.resume
+}
+
+func (d *Debugger) match(pc uint64, op OpCode, stack *Stack, contract *Contract, depth int, entered bool) *Breakpoint {
+	for _, bp := range d.breakpoints {
+		switch bp.Kind {
+		case BreakPC:
+			if bp.Pc == pc && (bp.Addr == (common.Address{}) || bp.Addr == contract.Address()) {
+				return bp
+			}
+		case BreakOp:
+			if bp.Op == op {
+				return bp
+			}
+		case BreakStorage:
+			if (op == SLOAD || op == SSTORE) && stack.len() > 0 && common.BigToHash(stack.Back(0)) == bp.Key {
+				return bp
+			}
+		case BreakDepth:
+			if entered && bp.Depth == depth {
+				return bp
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Debugger) CaptureStart(from common.Address, to common.Address, assetAddr common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := CALL
+	if create {
+		typ = CREATE
+	}
+	d.frames = []*DebugFrame{{Type: typ, From: from, To: to, Context: to, AssetAddr: assetAddr, Value: value, Gas: gas}}
+	d.entered = true
+	return nil
+}
+
+func (d *Debugger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (d *Debugger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (d *Debugger) CaptureEnter(typ OpCode, from common.Address, to common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) error {
+	// the code of to runs in the context of the caller
+	context := to
+	if typ == DELEGATECALL || typ == CALLCODE {
+		context = from
+	}
+	d.frames = append(d.frames, &DebugFrame{Type: typ, From: from, To: to, Context: context, AssetAddr: assetAddr, Value: value, Gas: gas})
+	d.entered = true
+	return nil
+}
+
+func (d *Debugger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	// a frame without code runs no instruction
+	d.entered = false
+	if len(d.frames) > 0 {
+		d.frames = d.frames[:len(d.frames)-1]
+	}
+	return nil
+}
+
+func (d *Debugger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	d.frames = nil
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestDebugger(t *testing.T) {
+	debugger := NewDebugger()
+	evm := newTracedEVM(t, debugger)
+
+	code := []byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = callReturn(append(code, byte(PUSH2), 0xff, 0xff, byte(CALL))...)
+	evm.StateDB.SetCode(testCaller, code)
+
+	var (
+		ret []byte
+		err error
+	)
+	state := debugger.Start(func() {
+		ret, _, err = evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 100000, new(big.Int))
+	})
+	if state == nil || state.Pc != 0 || state.Op != PUSH1 || state.Depth != 1 {
+		t.Fatalf("initial state mismatch: have %+v", state)
+	}
+	bp := debugger.AddBreakpoint(Breakpoint{Kind: BreakOp, Op: CALL})
+	if state = debugger.Continue(); state == nil || state.Breakpoint != bp || state.Op != CALL {
+		t.Fatalf("breakpoint state mismatch: have %+v", state)
+	}
+	// step into the callee, then back out to the instruction after the CALL
+	if state = debugger.Step(); state == nil || state.Depth != 2 || state.Pc != 0 {
+		t.Fatalf("callee state mismatch: have %+v", state)
+	}
+	if frames := debugger.Frames(); len(frames) != 2 || frames[1].Type != CALL || frames[1].To != testCallee {
+		t.Fatalf("frames mismatch: have %+v", frames)
+	}
+	if state = debugger.StepOut(); state == nil || state.Depth != 1 || state.Op != POP {
+		t.Fatalf("caller state mismatch: have %+v", state)
+	}
+	if err := state.SetStack(1, big.NewInt(1)); err == nil {
+		t.Errorf("expected error setting stack item out of range")
+	}
+	if err := state.SetMemory(math.MaxUint64, []byte{0xaa, 0xbb}); err == nil {
+		t.Errorf("expected error writing memory at an overflowing offset")
+	}
+	// the callee returned 0x2a into memory, patch it before it's returned
+	if err := state.SetMemory(31, []byte{0x2b}); err != nil {
+		t.Fatal(err)
+	}
+	if state = debugger.Continue(); state != nil {
+		t.Fatalf("expected execution to finish, paused at %+v", state)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ret) != 32 || ret[31] != 0x2b {
+		t.Errorf("return value mismatch: have %x", ret)
+	}
+	if debugger.Aborted() {
+		t.Errorf("finished execution reported as aborted")
+	}
+}
+
+func TestDebuggerBreakDepth(t *testing.T) {
+	debugger := NewDebugger()
+	evm := newTracedEVM(t, debugger)
+
+	code := []byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = callReturn(append(code, byte(PUSH2), 0xff, 0xff, byte(CALL))...)
+	evm.StateDB.SetCode(testCaller, code)
+
+	state := debugger.Start(func() {
+		evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 100000, new(big.Int))
+	})
+	if state == nil || state.Depth != 1 {
+		t.Fatalf("initial state mismatch: have %+v", state)
+	}
+	// the caller was entered already, returning to it doesn't break again
+	debugger.AddBreakpoint(Breakpoint{Kind: BreakDepth, Depth: 1})
+	bp := debugger.AddBreakpoint(Breakpoint{Kind: BreakDepth, Depth: 2})
+	if state = debugger.Continue(); state == nil || state.Breakpoint != bp || state.Pc != 0 {
+		t.Fatalf("callee state mismatch: have %+v", state)
+	}
+	if state = debugger.Continue(); state != nil {
+		t.Fatalf("expected execution to finish, paused at %+v", state)
+	}
+}
+
+func TestDebuggerFrameContext(t *testing.T) {
+	debugger := NewDebugger()
+	evm := newTracedEVM(t, debugger)
+
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = append(code, byte(GAS), byte(DELEGATECALL), byte(STOP))
+	evm.StateDB.SetCode(testCaller, code)
+
+	debugger.Start(func() {
+		evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 100000, new(big.Int))
+	})
+	debugger.AddBreakpoint(Breakpoint{Kind: BreakDepth, Depth: 2})
+	if state := debugger.Continue(); state == nil || state.Depth != 2 {
+		t.Fatalf("callee state mismatch: have %+v", state)
+	}
+	// the callee's code runs on the caller's storage
+	frames := debugger.Frames()
+	if frames[0].Context != testCaller || frames[1].To != testCallee || frames[1].Context != testCaller {
+		t.Errorf("frame context mismatch: have %+v, %+v", frames[0], frames[1])
+	}
+	debugger.Stop()
+}
+
+func TestDebuggerStop(t *testing.T) {
+	debugger := NewDebugger()
+	evm := newTracedEVM(t, debugger)
+	evm.StateDB.SetCode(testCaller, calleeCode)
+
+	var err error
+	state := debugger.Start(func() {
+		_, _, err = evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 100000, new(big.Int))
+	})
+	if state == nil {
+		t.Fatal("execution didn't pause")
+	}
+	debugger.Stop()
+	if !debugger.Aborted() || debugger.State() != nil {
+		t.Errorf("stopped execution not reported as aborted")
+	}
+	// a cancelled run returns no error, only Aborted tells it apart
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,6 +16,17 @@
 
 package vm
 
+import (
+	"errors"
+	"math/big"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/common/math"
+	"github.com/vm-project/types"
+	"github.com/vm-project/vm/log"
+	"github.com/vm-project/vm/params"
+)
+
 // ChainContext supports retrieving headers and consensus parameters from the
 // current blockchain to be used during transaction processing.
 //type ChainContext interface {
@@ -27,19 +38,6 @@ package vm
 //}
 //
 //
-//func NewMessage(from common.Address, to *common.Address, nonce uint64, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, checkNonce bool) Message {
-//	return Message{
-//		From:       from,
-//		To:         to,
-//		Nonce:      nonce,
-//		//amount:     amount,
-//		//gasLimit:   gasLimit,
-//		GasPrice:   gasPrice,
-//		Data:       data,
-//		//checkNonce: checkNonce,
-//	}
-//}
-//
 //// GetHashFn returns a GetHashFunc which retrieves header hashes by number
 //func GetHashFn(ref *types.Header, chain ChainContext) func(n uint64) common.Hash {
 //	var cache map[uint64]common.Hash
@@ -88,174 +86,242 @@ package vm
 //		GasPrice:    new(big.Int).Set(msg.GasPrice),
 //	}
 //}
-//
-//
-//// IntrinsicGas computes the 'intrinsic gas' for a message with the given data.
-//func IntrinsicGas(data []byte, contractCreation bool, homestead bool) (uint64, error) {
-//	// Set the starting gas for the raw transaction
-//	var gas uint64
-//	if contractCreation && homestead {
-//		gas = params.TxGasContractCreation
-//	} else {
-//		gas = params.TxGas
-//	}
-//	// Bump the required gas by the amount of transactional data
-//	if len(data) > 0 {
-//		// Zero and non-zero bytes are priced differently
-//		var nz uint64
-//		for _, byt := range data {
-//			if byt != 0 {
-//				nz++
-//			}
-//		}
-//		// Make sure we don't exceed uint64 for all data combinations
-//		if (math.MaxUint64-gas)/params.TxDataNonZeroGas < nz {
-//			return 0, ErrOutOfGas
-//		}
-//		gas += nz * params.TxDataNonZeroGas
-//
-//		z := uint64(len(data)) - nz
-//		if (math.MaxUint64-gas)/params.TxDataZeroGas < z {
-//			return 0, ErrOutOfGas
-//		}
-//		gas += z * params.TxDataZeroGas
-//	}
-//	return gas, nil
-//}
-//
-//
-//// to returns the recipient of the message.
-//func To(cfg *execConfig) common.Address {
-//	if cfg.msg.To == nil /* contract creation */ {
-//		return common.Address{}
-//	}
-//	return *cfg.msg.To
-//}
-//
-//
-//// TransactionExec will execute the transaction
-////return receipts, gas, error
-//func TransactionExec(exeCfg *execConfig,msg Message) (ret []byte, usedGas uint64, failed bool, err error){
-//
-//	if exeCfg != nil {
-//		return nil, 0, true,nil
-//	}
-//	if exeCfg.gp == nil {
-//		//cfg = new(Config)
-//		return nil, 0, true,nil
-//	}
-//	if preCheck(exeCfg) != nil {
-//		return nil, 0, true,nil
-//	}
-//	//
-//	if exeCfg.statedb == nil {
-//		//exeCfg.statedb, _ = state.New(common.Hash{}, state.NewDatabase(zdb.NewMemDatabase()))
-//		return nil, 0, true,nil
-//	}
-//
-//	//homestead := st.evm.ChainConfig().IsHomestead(st.evm.BlockNumber)
-//	contractCreation := msg.To == nil
-//
-//	// Pay intrinsic gas
-//	gas, err := IntrinsicGas(exeCfg.data, contractCreation, false)
-//	if err != nil {
-//		return nil, 0,true, err
-//	}
-//	if err = useGas(exeCfg,gas); err != nil {
-//		return nil, 0,true, err
-//	}
-//
-//	var (
-//		vm = exeCfg.vm
-//		// vm errors do not effect consensus and are therefor
-//		// not assigned to err, except for insufficient balance
-//		// error.
-//		vmerr error
-//	)
-//	//to address is nil
-//	if contractCreation {
-//		//
-//		ret, _, exeCfg.gas, vmerr = vm.Create(msg.From, msg.AssetId, exeCfg.data, msg.Gas, msg.Value)
-//	} else {
-//		// Increment the nonce for the next transaction
-//		//vm.Asset.SetNonce(msg.From, exeCfg.asset.GetNonce( msg.From ) + 1 )
-//		ret, exeCfg.gas, vmerr = vm.Call(msg.From, To(exeCfg), msg.AssetId,msg.Data, msg.Gas,msg.Value)
-//	}
-//
-//	if vmerr != nil {
-//		log.Debug("VM returned with error", "err", vmerr)
-//		// The only possible consensus-error would be if there wasn't
-//		// sufficient balance to make the transfer happen. The first
-//		// balance transfer may never fail.
-//		if vmerr == ErrInsufficientBalance {
-//			return nil, 0,true, vmerr
-//		}
-//	}
-//	refundGas(exeCfg)
-//	exeCfg.usedGas += gasUsed(exeCfg)
-//
-//	return ret, gas, false,err
-//}
-//
-//func refundGas(cfg *execConfig) {
-//	// Apply refund counter, capped to half of the used gas.
-//	refund := gasUsed(cfg) / 2
-//	if refund > cfg.statedb.GetRefund() {
-//		refund = cfg.statedb.GetRefund()
-//	}
-//	cfg.gas += refund
-//
-//	// Return for remaining gas, exchanged at the original rate.
-//	remaining := new(big.Int).Mul(new(big.Int).SetUint64(cfg.gas), cfg.gasPrice)
-//	cfg.asset.AddBalance(cfg.msg.From,*cfg.msg.AssetId ,remaining)
-//
-//	// Also return remaining gas to the block gas counter so it is
-//	// available for the next transaction.
-//	cfg.gp.AddGas(cfg.gas)
-//}
-//
-//// gasUsed returns the amount of gas used up by the state transition.
-//func gasUsed(cfg *execConfig) uint64 {
-//	return cfg.initialGas - cfg.gas
-//}
-//
-//
-//func  useGas(cfg *execConfig,amount uint64) error {
-//	if cfg.gas < amount {
-//		return vm.ErrOutOfGas
-//	}
-//	cfg.gas -= amount
-//
-//	return nil
-//}
-//
-//func buyGas(cfg *execConfig) error {
-//	mgval := new(big.Int).Mul(new(big.Int).SetUint64(cfg.msg.Gas), cfg.gasPrice)
-//	value := cfg.asset.GetBalance(cfg.msg.From,*cfg.msg.AssetId)
-//
-//	if value.(big.Int).Cmp(mgval) < 0 {
-//		return errors.New("insufficient balance to pay for gas")
-//	}
-//	if err := cfg.gp.SubGas(cfg.msg.Gas); err != nil {
-//		return err
-//	}
-//	cfg.gas += cfg.msg.Gas
-//
-//	cfg.initialGas = cfg.msg.Gas
-//	cfg.asset.SubBalance(cfg.msg.From,*cfg.msg.AssetId ,mgval)
-//	return nil
-//}
-//
-//func preCheck(cfg *execConfig) error {
-//	// Make sure this transaction's nonce is correct.
-//	if cfg.msg.CheckNonce {
-//		nonce := cfg.asset.GetNonce(cfg.msg.From)
-//
-//		if nonce < cfg.msg.Nonce {
-//			return errors.New("nonce too high")
-//		} else if nonce > cfg.msg.Nonce {
-//			return errors.New("nonce too low")
-//		}
-//	}
-//	return buyGas(cfg)
-//}
\ No newline at end of file
+
+var (
+	errNonceTooHigh              = errors.New("nonce too high")
+	errNonceTooLow               = errors.New("nonce too low")
+	errInsufficientBalanceForGas = errors.New("insufficient balance to pay for gas")
+)
+
+// NewMessage creates a message moving amount of assetId from from to to, a nil
+// to creates a contract. Gas is bought in assetId at gasPrice.
+func NewMessage(from common.Address, to *common.Address, assetId common.Address, nonce uint64, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, checkNonce bool) Message {
+	return Message{
+		From:       from,
+		To:         to,
+		AssetId:    assetId,
+		Nonce:      nonce,
+		Value:      amount,
+		Gas:        gasLimit,
+		GasPrice:   gasPrice,
+		Data:       data,
+		CheckNonce: checkNonce,
+	}
+}
+
+// ExecResult is the outcome of a message executed by TransactionExec.
+type ExecResult struct {
+	UsedGas    uint64 // Total gas used by the message, refunds deducted
+	ReturnData []byte // Data returned by the contract or the created code
+	Err        error  // Error returned by the VM, it does not invalidate the message
+
+	Receipt *types.Receipt // Receipt of the message within its block
+}
+
+// Failed reports whether the VM execution failed.
+func (r *ExecResult) Failed() bool {
+	return r.Err != nil
+}
+
+// IntrinsicGas computes the 'intrinsic gas' for a message with the given data.
+func IntrinsicGas(data []byte, contractCreation bool, homestead bool) (uint64, error) {
+	// Set the starting gas for the raw transaction
+	var gas uint64
+	if contractCreation && homestead {
+		gas = params.TxGasContractCreation
+	} else {
+		gas = params.TxGas
+	}
+	// Bump the required gas by the amount of transactional data
+	if len(data) > 0 {
+		// Zero and non-zero bytes are priced differently
+		var nz uint64
+		for _, byt := range data {
+			if byt != 0 {
+				nz++
+			}
+		}
+		// Make sure we don't exceed uint64 for all data combinations
+		if (math.MaxUint64-gas)/params.TxDataNonZeroGas < nz {
+			return 0, ErrOutOfGas
+		}
+		gas += nz * params.TxDataNonZeroGas
+
+		z := uint64(len(data)) - nz
+		if (math.MaxUint64-gas)/params.TxDataZeroGas < z {
+			return 0, ErrOutOfGas
+		}
+		gas += z * params.TxDataZeroGas
+	}
+	return gas, nil
+}
+
+// TransactionExec executes msg in the environment of evm, taking the gas out of
+// gp. It checks the nonce, buys the gas in the message asset, runs the call or
+// the contract creation, refunds the unused gas and pays the coinbase for the
+// used one. Logs are collected under the transaction set by StateDB.Prepare.
+// usedGas accumulates the gas used by the messages of the block and
+// is recorded in the receipt. The returned error is set when the message is
+// invalid and could not be executed at all, VM failures are reported by
+// ExecResult.Err, or when the unused gas or the fee can't be credited. An
+// invalid message leaves the state and gp as they were: the gas bought and
+// the nonce bumped are undone.
+func TransactionExec(evm *EVM, msg Message, gp *GasPool, usedGas *uint64) (result *ExecResult, err error) {
+	snapshot, available := evm.StateDB.Snapshot(), gp.Gas()
+	defer func() {
+		if err != nil {
+			evm.StateDB.RevertToSnapshot(snapshot)
+			*gp = GasPool(available)
+		}
+	}()
+	cfg := &execConfig{evm: evm, msg: msg, gp: gp, gasPrice: msg.GasPrice}
+	if cfg.gasPrice == nil {
+		cfg.gasPrice = new(big.Int)
+	}
+	if err := preCheck(cfg); err != nil {
+		return nil, err
+	}
+	contractCreation := msg.To == nil
+
+	// Pay intrinsic gas
+	gas, err := IntrinsicGas(msg.Data, contractCreation, evm.chainRules.IsHomestead)
+	if err != nil {
+		return nil, err
+	}
+	if err = useGas(cfg, gas); err != nil {
+		return nil, err
+	}
+
+	var (
+		sender = AccountRef(msg.From)
+		value  = msg.Value
+		ret    []byte
+		// address of the created contract, if any
+		contractAddr common.Address
+		// vm errors do not effect consensus and are therefor
+		// not assigned to err, except for insufficient balance
+		// error.
+		vmerr error
+	)
+	if value == nil {
+		value = new(big.Int)
+	}
+	if contractCreation {
+		ret, contractAddr, cfg.gas, vmerr = evm.Create(sender, msg.AssetId, msg.Data, cfg.gas, value)
+	} else {
+		// Increment the nonce for the next transaction
+		evm.Asset.SetNonce(msg.From, evm.Asset.GetNonce(msg.From)+1)
+		ret, cfg.gas, vmerr = evm.Call(sender, *msg.To, msg.AssetId, msg.Data, cfg.gas, value)
+	}
+	if vmerr != nil {
+		vmlog.DebugPrint("VM returned with error: %v", vmerr)
+		// The only possible consensus-error would be if there wasn't
+		// sufficient balance to make the transfer happen. The first
+		// balance transfer may never fail.
+		if vmerr == ErrInsufficientBalance {
+			return nil, vmerr
+		}
+	}
+	if err = refundGas(cfg); err != nil {
+		return nil, err
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed(cfg)), cfg.gasPrice)
+	if fee.Sign() > 0 {
+		if err = evm.Asset.AddBalance(evm.Coinbase, msg.AssetId, fee); err != nil {
+			return nil, err
+		}
+	}
+	// Update the state with pending changes, receipts before Byzantium
+	// commit to the intermediate state root instead of a status
+	var root []byte
+	if evm.chainRules.IsByzantium {
+		evm.StateDB.Finalise(true)
+	} else {
+		root = evm.StateDB.IntermediateRoot(evm.chainRules.IsEIP158).Bytes()
+	}
+	*usedGas += gasUsed(cfg)
+
+	// Create a new receipt for the message, storing the used gas and the
+	// address of the created contract
+	receipt := types.NewReceipt(root, vmerr != nil, *usedGas)
+	receipt.TxHash = evm.StateDB.TxHash()
+	receipt.GasUsed = gasUsed(cfg)
+	if contractCreation {
+		receipt.ContractAddress = contractAddr
+	}
+	// Set the receipt logs and create the bloom filter
+	receipt.Logs = evm.StateDB.GetLogs(receipt.TxHash)
+	receipt.Internal = evm.StateDB.GetInternalTxs(receipt.TxHash)
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+	return &ExecResult{UsedGas: gasUsed(cfg), ReturnData: ret, Err: vmerr, Receipt: receipt}, nil
+}
+
+func refundGas(cfg *execConfig) error {
+	// Apply refund counter, capped to half of the used gas.
+	refund := gasUsed(cfg) / 2
+	if refund > cfg.evm.StateDB.GetRefund() {
+		refund = cfg.evm.StateDB.GetRefund()
+	}
+	cfg.gas += refund
+
+	// Return for remaining gas, exchanged at the original rate.
+	remaining := new(big.Int).Mul(new(big.Int).SetUint64(cfg.gas), cfg.gasPrice)
+	if remaining.Sign() > 0 {
+		if err := cfg.evm.Asset.AddBalance(cfg.msg.From, cfg.msg.AssetId, remaining); err != nil {
+			return err
+		}
+	}
+
+	// Also return remaining gas to the block gas counter so it is
+	// available for the next transaction.
+	cfg.gp.AddGas(cfg.gas)
+	return nil
+}
+
+// gasUsed returns the amount of gas used up by the state transition.
+func gasUsed(cfg *execConfig) uint64 {
+	return cfg.initialGas - cfg.gas
+}
+
+func useGas(cfg *execConfig, amount uint64) error {
+	if cfg.gas < amount {
+		return ErrOutOfGas
+	}
+	cfg.gas -= amount
+
+	return nil
+}
+
+func buyGas(cfg *execConfig) error {
+	mgval := new(big.Int).Mul(new(big.Int).SetUint64(cfg.msg.Gas), cfg.gasPrice)
+	if mgval.Sign() > 0 {
+		if ok, _ := cfg.evm.Asset.EnoughBalance(cfg.msg.From, cfg.msg.AssetId, mgval); !ok {
+			return errInsufficientBalanceForGas
+		}
+	}
+	if err := cfg.gp.SubGas(cfg.msg.Gas); err != nil {
+		return err
+	}
+	cfg.gas += cfg.msg.Gas
+
+	cfg.initialGas = cfg.msg.Gas
+	if mgval.Sign() > 0 {
+		return cfg.evm.Asset.SubBalance(cfg.msg.From, cfg.msg.AssetId, mgval)
+	}
+	return nil
+}
+
+func preCheck(cfg *execConfig) error {
+	// Make sure this transaction's nonce is correct.
+	if cfg.msg.CheckNonce {
+		nonce := cfg.evm.Asset.GetNonce(cfg.msg.From)
+
+		if nonce < cfg.msg.Nonce {
+			return errNonceTooHigh
+		} else if nonce > cfg.msg.Nonce {
+			return errNonceTooLow
+		}
+	}
+	return buyGas(cfg)
+}
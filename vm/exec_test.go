@@ -0,0 +1,210 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/types"
+	"github.com/vm-project/vm/params"
+)
+
+func TestTransactionExec(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+	evm.Coinbase = common.BytesToAddress([]byte("coinbase"))
+	if err := a.IncreaseAsset(testCaller, assetAddr, big.NewInt(100000)); err != nil {
+		t.Fatal(err)
+	}
+
+	var usedGas uint64
+	gp := new(GasPool).AddGas(100000)
+	msg := NewMessage(testCaller, &testCallee, assetAddr, 0, big.NewInt(10), 50000, big.NewInt(1), nil, true)
+	res, err := TransactionExec(evm, msg, gp, &usedGas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Failed() {
+		t.Fatalf("execution failed: %v", res.Err)
+	}
+	if !bytes.Equal(res.ReturnData, common.LeftPadBytes([]byte{0x2a}, 32)) {
+		t.Errorf("return mismatch: have %x", res.ReturnData)
+	}
+	if res.UsedGas <= params.TxGas || res.UsedGas >= 50000 {
+		t.Errorf("used gas out of range: %d", res.UsedGas)
+	}
+	if gp.Gas() != 100000-res.UsedGas {
+		t.Errorf("gas pool mismatch: have %d, want %d", gp.Gas(), 100000-res.UsedGas)
+	}
+	fee := int64(res.UsedGas)
+	if balance := a.GetBalance(testCaller, assetAddr).(*big.Int); balance.Int64() != 101000-10-fee {
+		t.Errorf("sender balance mismatch: have %v, want %d", balance, 101000-10-fee)
+	}
+	if balance := a.GetBalance(evm.Coinbase, assetAddr).(*big.Int); balance.Int64() != fee {
+		t.Errorf("coinbase balance mismatch: have %v, want %d", balance, fee)
+	}
+	if r := res.Receipt; r.Status != types.ReceiptStatusSuccessful || r.GasUsed != res.UsedGas || r.CumulativeGasUsed != usedGas {
+		t.Errorf("receipt mismatch: have %v, gas %d", r, r.GasUsed)
+	}
+	if nonce := a.GetNonce(testCaller); nonce != 1 {
+		t.Errorf("nonce mismatch: have %d, want 1", nonce)
+	}
+
+	// replaying the same nonce is rejected before any state is touched
+	if _, err := TransactionExec(evm, msg, gp, &usedGas); err != errNonceTooLow {
+		t.Errorf("error mismatch: have %v, want %v", err, errNonceTooLow)
+	}
+	// gas the sender can not pay for is rejected too
+	msg = NewMessage(testCaller, &testCallee, assetAddr, 1, nil, 50000, big.NewInt(10), nil, true)
+	if _, err := TransactionExec(evm, msg, gp, &usedGas); err != errInsufficientBalanceForGas {
+		t.Errorf("error mismatch: have %v, want %v", err, errInsufficientBalanceForGas)
+	}
+}
+
+func TestTransactionExecInvalid(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+	if err := a.IncreaseAsset(testCaller, assetAddr, big.NewInt(100000)); err != nil {
+		t.Fatal(err)
+	}
+	balance := new(big.Int).Set(a.GetBalance(testCaller, assetAddr).(*big.Int))
+
+	// the gas is bought but the value can't be transferred
+	var usedGas uint64
+	gp := new(GasPool).AddGas(100000)
+	value := new(big.Int).Add(balance, big.NewInt(1))
+	msg := NewMessage(testCaller, &testCallee, assetAddr, 0, value, 50000, big.NewInt(1), nil, true)
+	if _, err := TransactionExec(evm, msg, gp, &usedGas); err != ErrInsufficientBalance {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrInsufficientBalance)
+	}
+	if have := a.GetBalance(testCaller, assetAddr).(*big.Int); have.Cmp(balance) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", have, balance)
+	}
+	if nonce := a.GetNonce(testCaller); nonce != 0 {
+		t.Errorf("nonce mismatch: have %d, want 0", nonce)
+	}
+	if gp.Gas() != 100000 || usedGas != 0 {
+		t.Errorf("gas mismatch: pool %d, used %d", gp.Gas(), usedGas)
+	}
+}
+
+func TestTransactionExecFeeFailure(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+	evm.Coinbase = common.BytesToAddress([]byte("coinbase"))
+	if err := a.IncreaseAsset(testCaller, assetAddr, big.NewInt(100000)); err != nil {
+		t.Fatal(err)
+	}
+	balance := new(big.Int).Set(a.GetBalance(testCaller, assetAddr).(*big.Int))
+	// a coinbase balance that can't be decoded fails the fee payment
+	evm.StateDB.SetAccount(evm.Coinbase, evm.Coinbase.String()+assetAddr.String(), []byte{0xff})
+
+	var usedGas uint64
+	gp := new(GasPool).AddGas(100000)
+	msg := NewMessage(testCaller, &testCallee, assetAddr, 0, big.NewInt(10), 50000, big.NewInt(1), nil, true)
+	if _, err := TransactionExec(evm, msg, gp, &usedGas); err == nil {
+		t.Fatal("fee payment to a corrupt coinbase balance succeeded")
+	}
+	if have := a.GetBalance(testCaller, assetAddr).(*big.Int); have.Cmp(balance) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want %v", have, balance)
+	}
+	if nonce := a.GetNonce(testCaller); nonce != 0 {
+		t.Errorf("nonce mismatch: have %d, want 0", nonce)
+	}
+	if gp.Gas() != 100000 || usedGas != 0 {
+		t.Errorf("gas mismatch: pool %d, used %d", gp.Gas(), usedGas)
+	}
+}
+
+func TestTransactionExecLogs(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+	if err := a.IncreaseAsset(testCaller, assetAddr, big.NewInt(100000)); err != nil {
+		t.Fatal(err)
+	}
+	// emits the word 42 with topic 7
+	logger := common.BytesToAddress([]byte("logger"))
+	evm.StateDB.SetCode(logger, []byte{
+		byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 7, byte(PUSH1), 32, byte(PUSH1), 0, byte(LOG1),
+	})
+	txHash := common.BytesToHash([]byte("tx"))
+	evm.StateDB.Prepare(txHash, 3)
+
+	var usedGas uint64
+	msg := NewMessage(testCaller, &logger, assetAddr, 0, nil, 50000, big.NewInt(1), nil, true)
+	res, err := TransactionExec(evm, msg, new(GasPool).AddGas(100000), &usedGas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := res.Receipt
+	if r.TxHash != txHash || len(r.Logs) != 1 {
+		t.Fatalf("receipt mismatch: hash %x, logs %v", r.TxHash, r.Logs)
+	}
+	if log := r.Logs[0]; log.Address != logger || log.TxIndex != 3 || log.Topics[0] != common.BytesToHash([]byte{7}) || !bytes.Equal(log.Data, common.LeftPadBytes([]byte{0x2a}, 32)) {
+		t.Errorf("log mismatch: %v", log)
+	}
+	if !types.BloomLookup(r.Bloom, logger) {
+		t.Errorf("bloom misses log address")
+	}
+}
+
+func TestTransactionExecInternalTxs(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+	if err := a.IncreaseAsset(testCaller, assetAddr, big.NewInt(100000)); err != nil {
+		t.Fatal(err)
+	}
+	callEx := func(to common.Address, value byte) []byte {
+		code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), value, byte(PUSH20)}
+		code = append(code, assetAddr.Bytes()...)
+		code = append(code, byte(PUSH20))
+		code = append(code, to.Bytes()...)
+		return append(code, byte(PUSH2), 0xff, 0xff, byte(CALLEX), byte(POP))
+	}
+	// moves 5 units to the callee, then 3 units to a contract that reverts
+	mover, reverter := common.BytesToAddress([]byte("mover")), common.BytesToAddress([]byte("reverter"))
+	evm.StateDB.SetCode(reverter, []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT)})
+	evm.StateDB.SetCode(mover, append(callEx(testCallee, 5), callEx(reverter, 3)...))
+	if err := a.SubBalance(testCaller, assetAddr, big.NewInt(10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.AddBalance(mover, assetAddr, big.NewInt(10)); err != nil {
+		t.Fatal(err)
+	}
+	txHash := common.BytesToHash([]byte("tx"))
+	evm.StateDB.Prepare(txHash, 1)
+
+	var usedGas uint64
+	msg := NewMessage(testCaller, &mover, assetAddr, 0, big.NewInt(1), 100000, big.NewInt(1), nil, true)
+	res, err := TransactionExec(evm, msg, new(GasPool).AddGas(100000), &usedGas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Failed() {
+		t.Fatalf("execution failed: %v", res.Err)
+	}
+	internal := res.Receipt.Internal
+	if len(internal) != 1 {
+		t.Fatalf("internal transaction count mismatch: have %d, want 1", len(internal))
+	}
+	itx := internal[0]
+	if itx.AssetAddr != assetAddr || itx.From != mover || itx.To != testCallee || itx.Amount.Int64() != 5 || itx.Depth != 1 || itx.Op != "CALLEX" || itx.Mint {
+		t.Errorf("internal transaction mismatch: have %+v", itx)
+	}
+	if itx.TxHash != txHash || itx.TxIndex != 1 {
+		t.Errorf("internal transaction context mismatch: have hash %x index %d", itx.TxHash, itx.TxIndex)
+	}
+}
@@ -319,8 +319,7 @@ func gasCall(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem
 		gas            = gt.Calls
 		transfersValue = stack.Back(2).Sign() != 0
 		address        = common.BigToAddress(stack.Back(1))
-		//eip158         = evm.ChainConfig().IsEIP158(evm.BlockNumber)
-		eip158         = true
+		eip158         = evm.chainRules.IsEIP158
 	)
 	if eip158 {
 		if transfersValue && evm.StateDB.Empty(address) {
@@ -385,28 +384,23 @@ func gasRevert(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, m
 
 func gasSuicide(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var gas uint64
-	//todo
 	// EIP150 homestead gas reprice fork:
-	//if evm.ChainConfig().IsEIP150(evm.BlockNumber) {
-	//	gas = gt.Suicide
-	//	var (
-	//		address = common.BigToAddress(stack.Back(0))
-	//		eip158  = evm.ChainConfig().IsEIP158(evm.BlockNumber)
-	//	)
-	//
-	//	if eip158 {
-	//		// if empty and transfers value
-	//		if evm.StateDB.Empty(address) && evm.StateDB.GetBalance(contract.Address()).Sign() != 0 {
-	//			gas += gt.CreateBySuicide
-	//		}
-	//	} else if !evm.StateDB.Exist(address) {
-	//		gas += gt.CreateBySuicide
-	//	}
-	//}
-
-	//if !evm.StateDB.HasSuicided(contract.Address()) {
-	//	evm.StateDB.AddRefund(params.SuicideRefundGas)
-	//}
+	if evm.chainRules.IsEIP150 {
+		gas = gt.Suicide
+		address := common.BigToAddress(stack.Back(0))
+
+		if evm.chainRules.IsEIP158 {
+			// sweeping funds into an empty account creates it
+			if evm.StateDB.Empty(address) && holdsAssets(evm, contract.Address()) {
+				gas += gt.CreateBySuicide
+			}
+		} else if !evm.StateDB.Exist(address) {
+			gas += gt.CreateBySuicide
+		}
+	}
+	if !evm.StateDB.HasSuicided(contract.Address()) {
+		evm.StateDB.AddRefund(params.SuicideRefundGas)
+	}
 	return gas, nil
 }
 
@@ -431,17 +425,64 @@ func gasDelegateCall(gt params.GasTable, evm *EVM, contract *Contract, stack *St
 }
 
 func gasAddAsset(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-
-	return 0, nil
+	return params.AddAssetGas, nil
 }
 
 func gasIssueAsset(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
-
-	return 0, nil
+	gas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	var overflow bool
+	if gas, overflow = math.SafeAdd(gas, params.IssueAssetGas); overflow {
+		return 0, errGasUintOverflow
+	}
+	// A descriptor outside of memory makes the issuance fail, it is charged
+	// the base price only.
+	if desc, ok := issueAssetDescriptor(mem, stack.Back(1)); ok {
+		if gas, overflow = math.SafeAdd(gas, uint64(len(desc))*params.IssueAssetDataGas); overflow {
+			return 0, errGasUintOverflow
+		}
+	}
+	return gas, nil
 }
+
+// gasCallEx prices CALLEX like CALL, with the asset id sitting between the
+// callee address and the value on the stack.
 func gasCallEx(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
+	var (
+		gas            = gt.Calls
+		transfersValue = stack.Back(3).Sign() != 0
+		address        = common.BigToAddress(stack.Back(1))
+		eip158         = evm.chainRules.IsEIP158
+	)
+	if eip158 {
+		if transfersValue && evm.StateDB.Empty(address) {
+			gas += params.CallNewAccountGas
+		}
+	} else if !evm.StateDB.Exist(address) {
+		gas += params.CallNewAccountGas
+	}
+	if transfersValue {
+		gas += params.CallValueTransferGas
+	}
+	memoryGas, err := memoryGasCost(mem, memorySize)
+	if err != nil {
+		return 0, err
+	}
+	var overflow bool
+	if gas, overflow = math.SafeAdd(gas, memoryGas); overflow {
+		return 0, errGasUintOverflow
+	}
 
-	return 0, nil
+	evm.callGasTemp, err = callGas(gt, contract.Gas, gas, stack.Back(0))
+	if err != nil {
+		return 0, err
+	}
+	if gas, overflow = math.SafeAdd(gas, evm.callGasTemp); overflow {
+		return 0, errGasUintOverflow
+	}
+	return gas, nil
 }
 
 func gasStaticCall(gt params.GasTable, evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
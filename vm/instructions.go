@@ -17,14 +17,17 @@
 package vm
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"github.com/vm-project/common"
 	"github.com/vm-project/common/math"
+	"github.com/vm-project/dep/asset"
 	"github.com/vm-project/dep/crypto"
 	"github.com/vm-project/vm/params"
 	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/vm/log"
 )
 
 var (
@@ -388,11 +391,36 @@ func opAddress(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *
 	return nil, nil
 }
 
+// assetBalance returns the balance of addr in the given asset, a zero asset id
+// selects the native asset.
+func assetBalance(evm *EVM, addr common.Address, assetId *big.Int) *big.Int {
+	assetAddr := common.BigToAddress(assetId)
+	if assetAddr == (common.Address{}) {
+		assetAddr = evm.NativeAsset
+	}
+	if balance, ok := evm.Asset.GetBalance(addr, assetAddr).(*big.Int); ok {
+		return balance
+	}
+	return new(big.Int)
+}
+
+// opBalance pushes the balance of an account in an asset.
+//
+// Stack: address, assetId => balance
 func opBalance(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
-	//slot := stack.peek()
-	//assetId := stack.peek()
-	//todo
-	//slot.Set( evm.Asset.GetBalance( common.BigToAddress(slot), assetId)  )
+	addr, assetId := stack.pop(), stack.peek()
+	assetId.Set(assetBalance(evm, common.BigToAddress(addr), assetId))
+
+	evm.interpreter.intPool.put(addr)
+	return nil, nil
+}
+
+// opSelfBalance pushes the balance of the executing contract in an asset.
+//
+// Stack: assetId => balance
+func opSelfBalance(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	assetId := stack.peek()
+	assetId.Set(assetBalance(evm, contract.Address(), assetId))
 	return nil, nil
 }
 
@@ -417,7 +445,7 @@ func opCallDataLoad(pc *uint64, evm *EVM, contract *Contract, memory *Memory, st
 }
 
 func opCallDataSize(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
-	fmt.Printf("opCallDataSize len=%d\n",len(contract.Input))
+	vmlog.DebugPrint("opCallDataSize len=%d\n",len(contract.Input))
 	stack.push(evm.interpreter.intPool.get().SetInt64(int64(len(contract.Input))))
 	return nil, nil
 }
@@ -642,9 +670,9 @@ func opCreate(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *S
 		assetAddr = common.BigToAddress(assetId)
 		gas          = contract.Gas
 	)
-	//if evm.ChainConfig().IsEIP150(evm.BlockNumber) {
-	//	gas -= gas / 64
-	//}
+	if evm.chainRules.IsEIP150 {
+		gas -= gas / 64
+	}
 
 	contract.UseGas(gas)
 	res, addr, returnGas, suberr := evm.Create(contract, assetAddr,input, gas, value)
@@ -652,15 +680,15 @@ func opCreate(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *S
 	// homestead we must check for CodeStoreOutOfGasError (homestead only
 	// rule) and treat as an error, if the ruleset is frontier we must
 	// ignore this error and pretend the operation was successful.
-	//if evm.ChainConfig().IsHomestead(evm.BlockNumber) && suberr == ErrCodeStoreOutOfGas {
-	//	stack.push(evm.interpreter.intPool.getZero())
-	if suberr != nil && suberr != ErrCodeStoreOutOfGas {
+	if evm.chainRules.IsHomestead && suberr == ErrCodeStoreOutOfGas {
+		stack.push(evm.interpreter.intPool.getZero())
+	} else if suberr != nil && suberr != ErrCodeStoreOutOfGas {
 		stack.push(evm.interpreter.intPool.getZero())
 	} else {
 		stack.push(addr.Big())
 	}
 	contract.Gas += returnGas
-	evm.interpreter.intPool.put(value, offset, size)
+	evm.interpreter.intPool.put(value, assetId, offset, size)
 
 	if suberr == errExecutionReverted {
 		return res, nil
@@ -668,18 +696,13 @@ func opCreate(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *S
 	return nil, nil
 }
 
-//not support
 func opCall(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
-	//fmt.Println("vm opCall instruction...")
-	var ret []byte
-	return ret, nil
 	// Pop gas. The actual gas in in evm.callGasTemp.
 	evm.interpreter.intPool.put(stack.pop())
 	gas := evm.callGasTemp
 	// Pop other call parameters.
-	addr, assetId,value, inOffset, inSize, retOffset, retSize := stack.pop(),stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
 	toAddr := common.BigToAddress(addr)
-	assetAddr := common.BigToAddress(assetId)
 	value = math.U256(value)
 	// Get the arguments from the memory.
 	args := memory.Get(inOffset.Int64(), inSize.Int64())
@@ -687,7 +710,7 @@ func opCall(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Sta
 	if value.Sign() != 0 {
 		gas += params.CallStipend
 	}
-	ret, returnGas, err := evm.Call(contract, toAddr,assetAddr, args, gas, value)
+	ret, returnGas, err := evm.Call(contract, toAddr, evm.NativeAsset, args, gas, value)
 	if err != nil {
 		stack.push(evm.interpreter.intPool.getZero())
 	} else {
@@ -707,11 +730,8 @@ func opCallCode(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack
 	evm.interpreter.intPool.put(stack.pop())
 	gas := evm.callGasTemp
 	// Pop other call parameters.
-	//addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	addr, assetId,value, inOffset, inSize, retOffset, retSize := stack.pop(),stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
-	//addr, assetId,value, inOffset, inSize, retOffset, retSize := stack.pop(),stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
+	addr, value, inOffset, inSize, retOffset, retSize := stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop(), stack.pop()
 	toAddr := common.BigToAddress(addr)
-	assetAddr := common.BigToAddress(assetId)
 	value = math.U256(value)
 	// Get arguments from the memory.
 	args := memory.Get(inOffset.Int64(), inSize.Int64())
@@ -719,7 +739,7 @@ func opCallCode(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack
 	if value.Sign() != 0 {
 		gas += params.CallStipend
 	}
-	ret, returnGas, err := evm.CallCode(contract, toAddr,assetAddr, args, gas, value)
+	ret, returnGas, err := evm.CallCode(contract, toAddr, evm.NativeAsset, args, gas, value)
 	if err != nil {
 		stack.push(evm.interpreter.intPool.getZero())
 	} else {
@@ -760,56 +780,95 @@ func opDelegateCall(pc *uint64, evm *EVM, contract *Contract, memory *Memory, st
 }
 
 //multi-asset
-//Increase asset already exist
+
+// opAddAsset mints value more units of an existing asset. The executing
+// contract has to be the owner of the asset, the minted units are credited
+// to it.
+//
+// Stack: assetId, value => success
 func opAddAsset(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
-	//
-	fmt.Println("vm opAddAsset instruction...")
-	//evm.Asset.IncreaseAsset(ownerAddr common.Address, assetAddr common.Address, value interface{})
-	value, assetId,addr := stack.pop(),stack.pop(), stack.pop()
-	ownerAddr := common.BigToAddress(addr)
+	assetId, value := stack.pop(), stack.pop()
 	assetAddr := common.BigToAddress(assetId)
 	value = math.U256(value)
 
-	fmt.Printf("vm opAddAsset %20x,%20x,%32x\n", ownerAddr,assetAddr,value)
-	//err :=  evm.Asset.IncreaseAsset(ownerAddr , assetAddr, value)
-	var err error
-	if err != nil {
+	if err := evm.Asset.IncreaseAsset(contract.Address(), assetAddr, new(big.Int).Set(value)); err != nil {
 		stack.push(evm.interpreter.intPool.getZero())
 	} else {
+		evm.addInternalTx(AddASSET, common.Address{}, contract.Address(), assetAddr, value, true)
 		stack.push(evm.interpreter.intPool.get().SetUint64(1))
 	}
-	return nil, err
+	evm.interpreter.intPool.put(assetId, value)
+	return nil, nil
 }
-//issue an asset for multi-asset
-func opIssueAsset(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ( []byte,error) {
-	// Pop other call parameters.
-	value,owner, assetId, addr := stack.pop(),stack.pop(), stack.pop(), stack.pop()
-	ownerAddr := common.BigToAddress(owner)
-	fromAddr := common.BigToAddress(addr)
-	assetType := common.BigToAddress(assetId)
-	value = math.U256(value)
-	fmt.Printf("vm opIssueAsset %20x,%20x,%20x,%32x\n", fromAddr,ownerAddr,assetType,value)
-	// Get the arguments from the memory.s
-	//args := memory.Get(value.Int64(), value.Int64())
-	len := memory.Get(value.Int64(), 32)
-	str := memory.Get(value.Int64()+32, 32)
-	fmt.Printf("vm opIssueAsset arg= %32x len =%32x \n", str,len)
-	//addr,err :=  evm.Asset.IssueAsset(assetType,fromAddr ,value,ownerAddr)
-	var err error
-	if err != nil {
+
+// issueAssetDescriptor returns the length-prefixed asset descriptor stored in
+// memory at offset, or false if it does not fit into the allocated memory.
+func issueAssetDescriptor(mem *Memory, offset *big.Int) ([]byte, bool) {
+	if !offset.IsUint64() || offset.Uint64() > uint64(mem.Len()) || uint64(mem.Len())-offset.Uint64() < 32 {
+		return nil, false
+	}
+	start := offset.Uint64() + 32
+	size := new(big.Int).SetBytes(mem.Data()[offset.Uint64():start])
+	if !size.IsUint64() || size.Uint64() > uint64(mem.Len())-start {
+		return nil, false
+	}
+	return mem.Data()[start : start+size.Uint64()], true
+}
+
+// opIssueAsset registers a new asset described by the JSON encoded
+// AccountAssetInfo found in memory. The descriptor is a 32 byte length
+// followed by the JSON bytes. The executing contract is the issuer and has to
+// be the owner of the asset, an empty owner defaults to the contract.
+//
+// Stack: baseType, offset => asset address, or 0 on failure
+func opIssueAsset(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	baseType, offset := stack.pop(), stack.pop()
+	defer evm.interpreter.intPool.put(baseType, offset)
+
+	fail := func() ([]byte, error) {
 		stack.push(evm.interpreter.intPool.getZero())
-	} else {
-		stack.push(evm.interpreter.intPool.get().SetUint64(1))
+		return nil, nil
+	}
+	if !baseType.IsUint64() || baseType.Uint64() != asset.AccountModel {
+		return fail()
+	}
+	desc, ok := issueAssetDescriptor(memory, offset)
+	if !ok {
+		return fail()
+	}
+	var info asset.AccountAssetInfo
+	if err := json.Unmarshal(desc, &info); err != nil || info.Total == nil || info.Total.Sign() < 0 {
+		return fail()
+	}
+	if info.Owner == (common.Address{}) {
+		info.Owner = contract.Address()
+	}
+	if info.Owner != contract.Address() {
+		return fail()
+	}
+	desc, err := json.Marshal(&info)
+	if err != nil {
+		return fail()
+	}
+	issuer := contract.Address()
+	nonce := evm.Asset.GetNonce(issuer)
+	assetAddr, err := evm.Asset.IssueAsset(asset.AccountModel, issuer, string(desc))
+	if err != nil {
+		return fail()
 	}
-	//todo
-	//evm.interpreter.intPool.put(addr, inOffset, inSize, retOffset, retSize)
-	return  nil,err
+	// the asset address derives from the issuer nonce, bump it so the next
+	// issuance can not collide with this one
+	evm.Asset.SetNonce(issuer, nonce+1)
+	evm.addInternalTx(ISSUEASSET, common.Address{}, info.Owner, assetAddr, info.Total, true)
+
+	stack.push(evm.interpreter.intPool.get().SetBytes(assetAddr.Bytes()))
+	return nil, nil
 }
 //for multi-asset
 func opCallEx(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	//
 	var ret []byte
-	fmt.Println("vm opCallEx instruction...")
+	vmlog.DebugPrint("vm opCallEx instruction...")
 	// Pop gas. The actual gas in in evm.callGasTemp.
 	evm.interpreter.intPool.put(stack.pop())
 	//gas available for the current call
@@ -825,7 +884,7 @@ func opCallEx(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *S
 	if value.Sign() != 0 {
 		gas += params.CallStipend
 	}
-	ret, returnGas, err := evm.Call(contract, toAddr,assetAddr, args, gas, value)
+	ret, returnGas, err := evm.CallEx(contract, toAddr, assetAddr, args, gas, value)
 	if err != nil {
 		stack.push(evm.interpreter.intPool.getZero())
 	} else {
@@ -836,7 +895,7 @@ func opCallEx(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *S
 	}
 	contract.Gas += returnGas
 
-	evm.interpreter.intPool.put(addr, value, inOffset, inSize, retOffset, retSize)
+	evm.interpreter.intPool.put(addr, assetId, value, inOffset, inSize, retOffset, retSize)
 	return ret, nil
 }
 
@@ -885,12 +944,38 @@ func opStop(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Sta
 	return nil, nil
 }
 
-func opSuicide(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
-	//todo
-	//balance := evm.EvmDB.GetBalance(contract.Address(),)
-	//evm.StateDB.AddBalance(common.BigToAddress(stack.pop()), balance)
+// holdsAssets reports whether addr has a non-zero balance in any asset.
+func holdsAssets(evm *EVM, addr common.Address) bool {
+	holdings, _ := evm.Asset.GetUserAssets(addr)
+	for _, holding := range holdings {
+		if holding.Balance != nil && holding.Balance.Sign() != 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	//evm.EvmDB.Suicide(contract.Address())
+// opSuicide sweeps every asset held by the contract to the beneficiary and
+// marks the contract for deletion at the end of the transaction.
+func opSuicide(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
+	beneficiary := common.BigToAddress(stack.pop())
+	holdings, err := evm.Asset.GetUserAssets(contract.Address())
+	if err != nil {
+		return nil, err
+	}
+	for _, holding := range holdings {
+		if holding.Balance == nil || holding.Balance.Sign() == 0 {
+			continue
+		}
+		if err := evm.Asset.SubBalance(contract.Address(), holding.AssetAddr, holding.Balance); err != nil {
+			return nil, err
+		}
+		if err := evm.Asset.AddBalance(beneficiary, holding.AssetAddr, holding.Balance); err != nil {
+			return nil, err
+		}
+		evm.addInternalTx(SELFDESTRUCT, contract.Address(), beneficiary, holding.AssetAddr, holding.Balance, false)
+	}
+	evm.StateDB.Suicide(contract.Address())
 	return nil, nil
 }
 
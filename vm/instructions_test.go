@@ -0,0 +1,356 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/asset"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/vm/params"
+)
+
+var (
+	testCaller = common.BytesToAddress([]byte("caller"))
+	testCallee = common.BytesToAddress([]byte("callee"))
+
+	// calleeCode stores 42 at memory 0 and returns the word.
+	calleeCode = []byte{
+		byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN),
+	}
+)
+
+func newTestEVM(t *testing.T) (*EVM, *asset.Asset, common.Address) {
+	state, _ := statedb.New(common.Hash{}, memdb.NewMemDatabase())
+	a := asset.NewAsset(state)
+	desc, _ := json.Marshal(&asset.AccountAssetInfo{
+		Name:     "test",
+		Symbol:   "TST",
+		Total:    big.NewInt(1000),
+		Decimals: 8,
+		Owner:    testCaller,
+	})
+	assetAddr, err := a.IssueAsset(asset.AccountModel, testCaller, string(desc))
+	if err != nil {
+		t.Fatalf("failed to issue asset: %v", err)
+	}
+	ctx := Context{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		BlockNumber: new(big.Int),
+		Time:        new(big.Int),
+		Difficulty:  new(big.Int),
+		GasPrice:    new(big.Int),
+		NativeAsset: assetAddr,
+	}
+	state.SetCode(testCallee, calleeCode)
+	return NewEVM(ctx, a, state, params.DefaultChainconfig, Config{}), a, assetAddr
+}
+
+// callReturn wraps a call opcode sequence so that the callee output, written
+// to memory 0, is returned.
+func callReturn(call ...byte) []byte {
+	return append(call, byte(POP), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN))
+}
+
+func TestOpCall(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+
+	code := []byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 7, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = callReturn(append(code, byte(PUSH2), 0xff, 0xff, byte(CALL))...)
+	evm.StateDB.SetCode(testCaller, code)
+
+	ret, _, err := evm.Call(AccountRef(testCaller), testCaller, assetAddr, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if new(big.Int).SetBytes(ret).Int64() != 0x2a {
+		t.Errorf("return mismatch: have %x, want 2a", ret)
+	}
+	if balance := a.GetBalance(testCallee, assetAddr).(*big.Int); balance.Int64() != 7 {
+		t.Errorf("callee balance mismatch: have %v, want 7", balance)
+	}
+}
+
+func TestTransferFailure(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+	// the debit goes through, the credit fails
+	errCredit := errors.New("credit failed")
+	evm.Transfer = func(a asset.Asset, sender, recipient, assetAddr common.Address, amount *big.Int) error {
+		if amount.Sign() == 0 {
+			return nil
+		}
+		a.SubBalance(sender, assetAddr, amount)
+		return errCredit
+	}
+	balance := a.GetBalance(testCaller, assetAddr).(*big.Int).Int64()
+
+	// a nested CALL moving 7 units fails and pushes 0
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 7, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = append(code, byte(GAS), byte(CALL), byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN))
+	evm.StateDB.SetCode(testCaller, code)
+	ret, _, err := evm.Call(AccountRef(testCaller), testCaller, assetAddr, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if new(big.Int).SetBytes(ret).Sign() != 0 {
+		t.Errorf("CALL with a failed transfer succeeded")
+	}
+	if _, _, err := evm.Call(AccountRef(testCaller), testCallee, assetAddr, nil, 100000, big.NewInt(7)); err != errCredit {
+		t.Errorf("call error mismatch: have %v, want %v", err, errCredit)
+	}
+	if _, _, _, err := evm.Create(AccountRef(testCaller), assetAddr, calleeCode, 100000, big.NewInt(7)); err != errCredit {
+		t.Errorf("create error mismatch: have %v, want %v", err, errCredit)
+	}
+	if have := a.GetBalance(testCaller, assetAddr).(*big.Int).Int64(); have != balance {
+		t.Errorf("caller balance mismatch: have %d, want %d", have, balance)
+	}
+	if itxs := evm.StateDB.GetInternalTxs(evm.StateDB.TxHash()); len(itxs) != 0 {
+		t.Errorf("failed transfers recorded: %v", itxs)
+	}
+}
+
+func TestOpCallEx(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+
+	code := []byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 5, byte(PUSH20)}
+	code = append(code, assetAddr.Bytes()...)
+	code = append(code, byte(PUSH20))
+	code = append(code, testCallee.Bytes()...)
+	code = callReturn(append(code, byte(PUSH2), 0xff, 0xff, byte(CALLEX))...)
+	evm.StateDB.SetCode(testCaller, code)
+
+	ret, _, err := evm.Call(AccountRef(testCaller), testCaller, assetAddr, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if new(big.Int).SetBytes(ret).Int64() != 0x2a {
+		t.Errorf("return mismatch: have %x, want 2a", ret)
+	}
+	if balance := a.GetBalance(testCaller, assetAddr).(*big.Int); balance.Int64() != 995 {
+		t.Errorf("caller balance mismatch: have %v, want 995", balance)
+	}
+}
+
+func TestCallExNewAccountGas(t *testing.T) {
+	config := &params.ChainConfig{
+		ChainID:        big.NewInt(1),
+		HomesteadBlock: big.NewInt(0),
+		EIP150Block:    big.NewInt(10),
+		EIP158Block:    big.NewInt(10),
+		ByzantiumBlock: big.NewInt(20),
+	}
+	missing := common.BytesToAddress([]byte("missing"))
+	tests := []struct {
+		block int64
+		value int64
+		want  uint64
+	}{
+		// before EIP-158 any call to a missing account creates it
+		{0, 0, params.CallNewAccountGas},
+		{0, 1, params.CallNewAccountGas + params.CallValueTransferGas},
+		// afterwards only value transfers into empty accounts do
+		{10, 0, 0},
+		{10, 1, params.CallNewAccountGas + params.CallValueTransferGas},
+	}
+	for _, test := range tests {
+		state, _ := statedb.New(common.Hash{}, memdb.NewMemDatabase())
+		evm := NewEVM(Context{BlockNumber: big.NewInt(test.block)}, asset.NewAsset(state), state, config, Config{})
+		stack := newstack()
+		stack.pushN(big.NewInt(test.value), new(big.Int), missing.Big(), new(big.Int))
+		contract := NewContract(AccountRef(testCaller), AccountRef(testCaller), new(big.Int), 100000)
+
+		gas, err := gasCallEx(params.GasTableHomestead, evm, contract, stack, NewMemory(), 0)
+		if err != nil {
+			t.Fatalf("block %d, value %d: %v", test.block, test.value, err)
+		}
+		if want := params.GasTableHomestead.Calls + test.want; gas != want {
+			t.Errorf("block %d, value %d: gas mismatch: have %d, want %d", test.block, test.value, gas, want)
+		}
+	}
+}
+
+func TestOpCreate(t *testing.T) {
+	evm, _, assetAddr := newTestEVM(t)
+
+	// CREATE takes value, asset, offset and size, three items underflow
+	evm.StateDB.SetCode(testCaller, []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(CREATE)})
+	if _, _, err := evm.Call(AccountRef(testCaller), testCaller, assetAddr, nil, 100000, new(big.Int)); err == nil {
+		t.Error("three item CREATE succeeded")
+	}
+
+	// the init code is calleeCode, right aligned in the first memory word
+	code := append([]byte{byte(PUSH10)}, calleeCode...)
+	code = append(code, byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), byte(len(calleeCode)), byte(PUSH1), byte(32-len(calleeCode)), byte(PUSH20))
+	code = append(code, assetAddr.Bytes()...)
+	code = append(code, byte(PUSH1), 0, byte(CREATE), byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN))
+	evm.StateDB.SetCode(testCaller, code)
+
+	ret, _, err := evm.Call(AccountRef(testCaller), testCaller, assetAddr, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.BytesToAddress(ret)
+	if have := evm.StateDB.GetCode(addr); !bytes.Equal(have, common.LeftPadBytes([]byte{0x2a}, 32)) {
+		t.Errorf("created code mismatch: have %x", have)
+	}
+}
+
+// issueAssetCode copies the length-prefixed descriptor to memory, issues the
+// asset, mints 50 more units of it and returns the asset address.
+func issueAssetCode(desc []byte) []byte {
+	blob := append(common.LeftPadBytes(big.NewInt(int64(len(desc))).Bytes(), 32), desc...)
+	body := []byte{
+		byte(PUSH1), 0, byte(PUSH1), byte(asset.AccountModel), byte(ISSUEASSET),
+		byte(DUP1), byte(PUSH1), 50, byte(SWAP1), byte(AddASSET), byte(POP),
+		byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN),
+	}
+	offset := 9 + len(body)
+	code := []byte{
+		byte(PUSH2), byte(len(blob) >> 8), byte(len(blob)),
+		byte(PUSH2), byte(offset >> 8), byte(offset),
+		byte(PUSH1), 0, byte(CODECOPY),
+	}
+	code = append(code, body...)
+	return append(code, blob...)
+}
+
+func TestOpIssueAsset(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+
+	desc, _ := json.Marshal(&asset.AccountAssetInfo{Name: "token", Symbol: "TKN", Total: big.NewInt(100), Decimals: 2})
+	evm.StateDB.SetCode(testCallee, issueAssetCode(desc))
+
+	ret, _, err := evm.Call(AccountRef(testCaller), testCallee, assetAddr, nil, 200000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := common.BytesToAddress(ret)
+	if issued == (common.Address{}) {
+		t.Fatal("asset was not issued")
+	}
+	if balance := a.GetBalance(testCallee, issued).(*big.Int); balance.Int64() != 150 {
+		t.Errorf("issuer balance mismatch: have %v, want 150", balance)
+	}
+	if nonce := a.GetNonce(testCallee); nonce != 1 {
+		t.Errorf("issuer nonce mismatch: have %d, want 1", nonce)
+	}
+
+	// Issuing on behalf of another owner is refused.
+	desc, _ = json.Marshal(&asset.AccountAssetInfo{Name: "token", Symbol: "TKN", Total: big.NewInt(100), Owner: testCaller})
+	evm.StateDB.SetCode(testCallee, issueAssetCode(desc))
+
+	ret, _, err = evm.Call(AccountRef(testCaller), testCallee, assetAddr, nil, 200000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued := common.BytesToAddress(ret); issued != (common.Address{}) {
+		t.Errorf("asset issued for foreign owner: %x", issued)
+	}
+}
+
+func TestOpBalance(t *testing.T) {
+	evm, _, assetAddr := newTestEVM(t)
+
+	// BALANCE(caller, asset) + BALANCE(caller, native) + SELFBALANCE(unknown asset)
+	code := []byte{byte(PUSH20)}
+	code = append(code, assetAddr.Bytes()...)
+	code = append(code, byte(PUSH20))
+	code = append(code, testCaller.Bytes()...)
+	code = append(code, byte(BALANCE), byte(PUSH1), 0, byte(PUSH20))
+	code = append(code, testCaller.Bytes()...)
+	code = append(code, byte(BALANCE), byte(ADD), byte(PUSH1), 0xee, byte(SELFBALANCE), byte(ADD),
+		byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN))
+	evm.StateDB.SetCode(testCallee, code)
+
+	ret, _, err := evm.Call(AccountRef(testCaller), testCallee, assetAddr, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance := new(big.Int).SetBytes(ret); balance.Int64() != 2000 {
+		t.Errorf("balance mismatch: have %v, want 2000", balance)
+	}
+}
+
+func TestOpSuicide(t *testing.T) {
+	evm, a, assetAddr := newTestEVM(t)
+
+	// the contract holds 300 units and self-destructs in favour of testCallee
+	if err := a.SubBalance(testCaller, assetAddr, big.NewInt(300)); err != nil {
+		t.Fatal(err)
+	}
+	contractAddr := common.BytesToAddress([]byte("suicide"))
+	if err := a.AddBalance(contractAddr, assetAddr, big.NewInt(300)); err != nil {
+		t.Fatal(err)
+	}
+	code := append([]byte{byte(PUSH20)}, testCallee.Bytes()...)
+	evm.StateDB.SetCode(contractAddr, append(code, byte(SELFDESTRUCT)))
+
+	if _, _, err := evm.Call(AccountRef(testCaller), contractAddr, assetAddr, nil, 100000, new(big.Int)); err != nil {
+		t.Fatal(err)
+	}
+	if !evm.StateDB.HasSuicided(contractAddr) {
+		t.Fatal("contract not marked suicided")
+	}
+	if balance := a.GetBalance(testCallee, assetAddr).(*big.Int); balance.Int64() != 300 {
+		t.Errorf("beneficiary balance mismatch: have %v, want 300", balance)
+	}
+	if refund := evm.StateDB.GetRefund(); refund != params.SuicideRefundGas {
+		t.Errorf("refund mismatch: have %d, want %d", refund, params.SuicideRefundGas)
+	}
+	evm.StateDB.Finalise(true)
+	if evm.StateDB.Exist(contractAddr) {
+		t.Error("contract survived finalisation")
+	}
+}
+
+func TestStaticCallWriteProtection(t *testing.T) {
+	evm, _, assetAddr := newTestEVM(t)
+
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"SSTORE", []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE)}},
+		{"LOG0", []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(LOG0)}},
+		{"ADDASSET", append(append([]byte{byte(PUSH1), 1, byte(PUSH20)}, assetAddr.Bytes()...), byte(AddASSET))},
+		{"ISSUEASSET", []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(ISSUEASSET)}},
+		{"CALL", callReturn(append(append([]byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 1, byte(PUSH20)}, testCallee.Bytes()...), byte(GAS), byte(CALL))...)},
+		{"CALLEX", callReturn(append(append(append(append([]byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 1, byte(PUSH20)}, assetAddr.Bytes()...), byte(PUSH20)), testCallee.Bytes()...), byte(GAS), byte(CALLEX))...)},
+	}
+	for _, test := range tests {
+		addr := common.BytesToAddress([]byte(test.name))
+		evm.StateDB.SetCode(addr, test.code)
+		if _, _, err := evm.StaticCall(AccountRef(testCaller), addr, nil, 100000); err != errWriteProtection {
+			t.Errorf("%s: error mismatch: have %v, want %v", test.name, err, errWriteProtection)
+		}
+	}
+	// a value-less call is fine
+	evm.StateDB.SetCode(testCaller, callReturn(append(append([]byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}, testCallee.Bytes()...), byte(GAS), byte(CALL))...))
+	if _, _, err := evm.StaticCall(AccountRef(testCaller), testCaller, nil, 100000); err != nil {
+		t.Errorf("value-less call failed: %v", err)
+	}
+}
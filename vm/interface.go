@@ -23,40 +23,19 @@ import (
 	"github.com/vm-project/common"
 )
 
-// execConfig provide basic config data for running
-//all parameter transaction needed
-//type execConfig struct {
-//	//total gas of block
-//	gp         *GasPool
-//    //
-//	vm         *vm.EVM
-//	//global config
-//	config     params.ChainConfig
-//	//
-//	tx         *types.Transaction
-//	//
-//	bc          ChainContext
-//	//
-//	header     *types.Header
-//	//all Transactions in block total used
-//	usedGas     uint64
-//	//from
-//	author     *common.Address
-//	//
-//	statedb    *statedb.StateDB
-//	//asset func
-//	asset     *asset.Asset
-//	//
-//	cfg         vm.Config
-//	//gas used
-//	gas        uint64
-//	//
-//	gasPrice   *big.Int
-//	//Gas already get via buy gas
-//	initialGas uint64
-//	//contract data,input data
-//	data       []byte
-//}
+// execConfig holds the state of a message executed by TransactionExec
+type execConfig struct {
+	//total gas of block
+	gp  *GasPool
+	evm *EVM
+	msg Message
+	//gas left
+	gas uint64
+	//
+	gasPrice *big.Int
+	//Gas already get via buy gas
+	initialGas uint64
+}
 
 // Message represents a message sent to a contract.
 //one msg only process one operation
@@ -82,29 +61,3 @@ type Message struct {
 	//contract data,input data
 	Data []byte
 }
-
-//// Receipt represents the results of a transaction.
-//type Receipt struct {
-//	// Consensus fields
-//	PostState         []byte        `json:"root"`
-//	Status            uint64        `json:"status"`
-//	Internal          []*InternalTx `json:"internal" `
-//	CumulativeGasUsed uint64        `json:"cumulativeGasUsed"`
-//	Bloom             Bloom         `json:"logsBloom"        `
-//	Logs              []*Log        `json:"logs"             `
-//
-//	// Implementation fields (don't reorder!)
-//	TxHash          common.Hash    `json:"transactionHash"`
-//	ContractAddress common.Address `json:"contractAddress"`
-//	GasUsed         uint64         `json:"gasUsed"`
-//}
-//zipper vm interface for external use
-type zvm interface{
-
-	NewExecConfig()
-	//
-	NewMessage(from common.Address, to *common.Address, nonce uint64, amount *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, checkNonce bool) Message
-	//NewMessage( Address,  *Address,  uint64,  *big.Int,  uint64,  *big.Int,  []byte,  bool) Message
-	//
-	//TransactionExec( *execConfig, *Message) (*Receipt, uint64, error)
-}
@@ -34,6 +34,9 @@ type Config struct {
 	ForceJit bool
 	// Tracer is the op code logger
 	Tracer Tracer
+	// Source optionally locates instructions in their source, execution
+	// errors and traces then report source positions.
+	Source SourceResolver
 	// NoRecursion disabled Interpreter call, callcode,
 	// delegate call and create.
 	NoRecursion bool
@@ -56,6 +59,7 @@ type Interpreter struct {
 	cfg      Config
 	gasTable  params.GasTable
 	intPool  *intPool
+	stepper  StepTracer // cfg.Tracer, if it wants to see steps before they are charged
 
 	readOnly   bool   // Whether to throw on stateful modifications
 	returnData []byte // Last CALL's return data for subsequent reuse
@@ -68,39 +72,40 @@ func NewInterpreter(evm *EVM, cfg Config) *Interpreter {
 	// we'll set the default jump table.
 	if !cfg.JumpTable[STOP].valid {
 		switch {
-		//case evm.ChainConfig().IsConstantinople(evm.BlockNumber):
-		//	cfg.JumpTable = constantinopleInstructionSet
-		//case evm.ChainConfig().IsByzantium(evm.BlockNumber):
-		//	cfg.JumpTable = byzantiumInstructionSet
-		//case evm.ChainConfig().IsHomestead(evm.BlockNumber):
-		//	cfg.JumpTable = homesteadInstructionSet
-		default:
-			//cfg.JumpTable = frontierInstructionSet
+		case evm.chainRules.IsConstantinople:
 			cfg.JumpTable = constantinopleInstructionSet
+		case evm.chainRules.IsByzantium:
+			cfg.JumpTable = byzantiumInstructionSet
+		case evm.chainRules.IsHomestead:
+			cfg.JumpTable = homesteadInstructionSet
+		default:
+			cfg.JumpTable = frontierInstructionSet
 		}
 	}
 
+	stepper, _ := cfg.Tracer.(StepTracer)
+
 	return &Interpreter{
 		evm:      evm,
 		cfg:      cfg,
-		gasTable: params.GasTableEIP158,
+		gasTable: evm.ChainConfig().GasTable(evm.BlockNumber),
 		intPool:  newIntPool(),
+		stepper:  stepper,
 	}
 }
 
 func (in *Interpreter) enforceRestrictions(op OpCode, operation operation, stack *Stack) error {
-	//if in.evm.chainRules.IsByzantium {
-	//	if in.readOnly {
-	//		// If the interpreter is operating in readonly mode, make sure no
-	//		// state-modifying operation is performed. The 3rd stack item
-	//		// for a call operation is the value. Transferring value from one
-	//		// account to the others means the state is modified and should also
-	//		// return with an error.
-	//		if operation.writes || (op == CALL && stack.Back(2).BitLen() > 0) {
-	//			return errWriteProtection
-	//		}
-	//	}
-	//}
+	if in.evm.chainRules.IsByzantium && in.readOnly {
+		// If the interpreter is operating in readonly mode, make sure no
+		// state-modifying operation is performed. The 3rd stack item
+		// for a call operation is the value, the 4th one for CALLEX which
+		// carries the asset id in front of it. Transferring value from one
+		// account to the others means the state is modified and should also
+		// return with an error.
+		if operation.writes || (op == CALL && stack.Back(2).BitLen() > 0) || (op == CALLEX && stack.Back(3).BitLen() > 0) {
+			return errWriteProtection
+		}
+	}
 	return nil
 }
 
@@ -112,7 +117,7 @@ func (in *Interpreter) enforceRestrictions(op OpCode, operation operation, stack
 // errExecutionReverted which means revert-and-keep-gas-left.
 func (in *Interpreter) Run(contract *Contract, input []byte) (ret []byte, err error) {
 	// Increment the call depth which is restricted to 1024
-	fmt.Println("interpreter run...")
+	vmlog.DebugPrint("interpreter run...")
 	in.evm.depth++
 	defer func() { in.evm.depth-- }()
 
@@ -140,7 +145,16 @@ func (in *Interpreter) Run(contract *Contract, input []byte) (ret []byte, err er
 		logged  bool   // deferred Tracer should ignore already logged steps
 	)
 	contract.Input = input
-	fmt.Printf("Interpreter input len=%d  l=%d\n",len(input),len(contract.Input))
+	if in.cfg.Source != nil {
+		defer func() {
+			if err != nil && err != errExecutionReverted {
+				if pos, ok := in.cfg.Source(contract.CodeHash, pc); ok {
+					err = &SourceError{Pos: pos, Err: err}
+				}
+			}
+		}()
+	}
+	vmlog.DebugPrint("Interpreter input len=%d  l=%d\n",len(input),len(contract.Input))
 	if in.cfg.Debug {
 		defer func() {
 			if err != nil {
@@ -165,9 +179,12 @@ func (in *Interpreter) Run(contract *Contract, input []byte) (ret []byte, err er
 		// Get the operation from the jump table and validate the stack to ensure there are
 		// enough stack items available to perform the operation.
 		op = contract.GetOp(pc)
+		if in.cfg.Debug && in.stepper != nil {
+			in.stepper.CaptureStep(in.evm, pc, op, contract.Gas, mem, stack, contract, in.evm.depth)
+		}
 		//fmt.Println("interpreter pc=",pc,"code=%x",contract.Code[pc],"name=",op)
 		vmlog.DebugPrint("interpreter pc=%d\t",pc)
-		vmlog.DebugPrint("code=%x\t",contract.Code[pc])
+		vmlog.DebugPrint("code=%x\t",byte(op))
 		vmlog.DebugPrint("name=%s\n",op)
 		operation := in.cfg.JumpTable[op]
 		//fmt.Printf("before operation.execute 1 \n")
@@ -193,7 +210,7 @@ func (in *Interpreter) Run(contract *Contract, input []byte) (ret []byte, err er
 			memSize, overflow := bigUint64(operation.memorySize(stack))
 			if overflow {
 				fmt.Errorf("invalid errGasUintOverflow ")
-				fmt.Printf("overflow memsize=%d\n",memSize)
+				vmlog.DebugPrint("overflow memsize=%d\n",memSize)
 				return nil, errGasUintOverflow
 			}
 			//fmt.Printf("before operation.execute 31 \n")
@@ -227,8 +244,8 @@ func (in *Interpreter) Run(contract *Contract, input []byte) (ret []byte, err er
 		// execute the operation
 		res, err := operation.execute(&pc, in.evm, contract, mem, stack)
 
-		stack.Print1()
-		mem.Print()
+		vmlog.DebugPrint("stack=%x", stack.Data())
+		vmlog.DebugPrint("memory=%x", mem.Data())
 		// verifyPool is a build flag. Pool verification makes sure the integrity
 		// of the integer pool by comparing values to a default value.
 		if verifyPool {
@@ -0,0 +1,72 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/asset"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/vm/params"
+)
+
+func TestForkSelection(t *testing.T) {
+	config := &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(10),
+		EIP158Block:         big.NewInt(10),
+		ByzantiumBlock:      big.NewInt(20),
+		ConstantinopleBlock: big.NewInt(30),
+	}
+	tests := []struct {
+		block       int64
+		jumpTable   [256]operation
+		gasTable    params.GasTable
+		precompiles map[common.Address]PrecompiledContract
+	}{
+		{0, homesteadInstructionSet, params.GasTableHomestead, PrecompiledContractsHomestead},
+		{15, homesteadInstructionSet, params.GasTableEIP158, PrecompiledContractsHomestead},
+		{20, byzantiumInstructionSet, params.GasTableEIP158, PrecompiledContractsByzantium},
+		{30, constantinopleInstructionSet, params.GasTableEIP158, PrecompiledContractsByzantium},
+	}
+	for _, test := range tests {
+		state, _ := statedb.New(common.Hash{}, memdb.NewMemDatabase())
+		evm := NewEVM(Context{BlockNumber: big.NewInt(test.block)}, asset.NewAsset(state), state, config, Config{})
+
+		for op := range test.jumpTable {
+			if evm.interpreter.cfg.JumpTable[op].valid != test.jumpTable[op].valid {
+				t.Errorf("block %d: opcode %v validity mismatch", test.block, OpCode(op))
+			}
+		}
+		if evm.interpreter.gasTable != test.gasTable {
+			t.Errorf("block %d: gas table mismatch: have %+v, want %+v", test.block, evm.interpreter.gasTable, test.gasTable)
+		}
+		if len(evm.precompiles()) != len(test.precompiles) {
+			t.Errorf("block %d: precompile count mismatch: have %d, want %d", test.block, len(evm.precompiles()), len(test.precompiles))
+		}
+	}
+	// a missing block number selects the genesis rules and tables
+	state, _ := statedb.New(common.Hash{}, memdb.NewMemDatabase())
+	evm := NewEVM(Context{}, asset.NewAsset(state), state, config, Config{})
+	if !evm.chainRules.IsHomestead || !evm.interpreter.cfg.JumpTable[DELEGATECALL].valid || evm.interpreter.gasTable != params.GasTableHomestead {
+		t.Errorf("nil block: rules mismatch: have %+v", evm.chainRules)
+	}
+}
@@ -79,6 +79,12 @@ func NewConstantinopleInstructionSet() [256]operation {
 		validateStack: makeStackFunc(2, 1),
 		valid:         true,
 	}
+	instructionSet[SELFBALANCE] = operation{
+		execute:       opSelfBalance,
+		gasCost:       constGasFunc(GasFastStep),
+		validateStack: makeStackFunc(1, 1),
+		valid:         true,
+	}
 
 	return instructionSet
 }
@@ -93,26 +99,25 @@ func NewByzantiumInstructionSet() [256]operation {
 	instructionSet[AddASSET] = operation{
 		execute:       opAddAsset,
 		gasCost:       gasAddAsset,
-		validateStack: makeStackFunc(7, 1),
-		memorySize:    memoryCall,
+		validateStack: makeStackFunc(2, 1),
 		valid:         true,
-		returns:       true,
+		writes:        true,
 	}
 
 	instructionSet[ISSUEASSET] = operation{
 		execute:       opIssueAsset,
 		gasCost:       gasIssueAsset,
 		validateStack: makeStackFunc(2, 1),
-		//memorySize:    memoryCall,
+		memorySize:    memoryIssueAsset,
 		valid:         true,
-		returns:       true,
+		writes:        true,
 	}
 
 	instructionSet[CALLEX] = operation{
 		execute:       opCallEx,
 		gasCost:       gasCallEx,
-		validateStack: makeStackFunc(7, 1),
-		memorySize:    memoryCall,
+		validateStack: makeStackFunc(8, 1),
+		memorySize:    memoryCallEx,
 		valid:         true,
 		returns:       true,
 	}
@@ -323,7 +328,7 @@ func NewFrontierInstructionSet() [256]operation {
 		BALANCE: {
 			execute:       opBalance,
 			gasCost:       gasBalance,
-			validateStack: makeStackFunc(1, 1),
+			validateStack: makeStackFunc(2, 1),
 			valid:         true,
 		},
 		ORIGIN: {
@@ -937,7 +942,7 @@ func NewFrontierInstructionSet() [256]operation {
 		CREATE: {
 			execute:       opCreate,
 			gasCost:       gasCreate,
-			validateStack: makeStackFunc(3, 1),
+			validateStack: makeStackFunc(4, 1),
 			memorySize:    memoryCreate,
 			valid:         true,
 			writes:        true,
@@ -955,7 +960,7 @@ func NewFrontierInstructionSet() [256]operation {
 			execute:       opCallCode,
 			gasCost:       gasCallCode,
 			validateStack: makeStackFunc(7, 1),
-			memorySize:    memoryCall,
+			memorySize:    memoryCallCode,
 			valid:         true,
 			returns:       true,
 		},
@@ -0,0 +1,198 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/vm-project/common"
+)
+
+// revertSelector is the selector of Error(string), the ABI encoding
+// solidity uses for the reason of a revert.
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// CallFrame is a single call of the tree built by CallTracer, with the
+// calls it made nested below it.
+type CallFrame struct {
+	Type         OpCode
+	From         common.Address
+	To           common.Address
+	AssetAddr    common.Address
+	Value        *big.Int
+	Gas          uint64
+	GasUsed      uint64
+	Input        []byte
+	Output       []byte
+	Error        string
+	RevertReason string
+	Calls        []*CallFrame
+}
+
+// callFrameJSON is the JSON form of CallFrame, addresses, amounts and data
+// are 0x prefixed hex.
+type callFrameJSON struct {
+	Type         string       `json:"type"`
+	From         string       `json:"from"`
+	To           string       `json:"to"`
+	AssetAddr    string       `json:"asset,omitempty"`
+	Value        string       `json:"value,omitempty"`
+	Gas          uint64       `json:"gas"`
+	GasUsed      uint64       `json:"gasUsed"`
+	Input        string       `json:"input"`
+	Output       string       `json:"output,omitempty"`
+	Error        string       `json:"error,omitempty"`
+	RevertReason string       `json:"revertReason,omitempty"`
+	Calls        []*CallFrame `json:"calls,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (f *CallFrame) MarshalJSON() ([]byte, error) {
+	enc := callFrameJSON{
+		Type:         f.Type.String(),
+		From:         common.ToHex(f.From[:]),
+		To:           common.ToHex(f.To[:]),
+		Gas:          f.Gas,
+		GasUsed:      f.GasUsed,
+		Input:        "0x" + common.Bytes2Hex(f.Input),
+		Error:        f.Error,
+		RevertReason: f.RevertReason,
+		Calls:        f.Calls,
+	}
+	if f.AssetAddr != (common.Address{}) {
+		enc.AssetAddr = common.ToHex(f.AssetAddr[:])
+	}
+	if f.Value != nil {
+		enc.Value = common.ToHex(f.Value.Bytes())
+	}
+	if len(f.Output) > 0 {
+		enc.Output = "0x" + common.Bytes2Hex(f.Output)
+	}
+	return json.Marshal(&enc)
+}
+
+// CallTracer is a Tracer that builds the tree of calls and contract
+// creations of an execution, along with the assets moved by each of them.
+type CallTracer struct {
+	stack []*CallFrame
+	root  *CallFrame
+}
+
+// NewCallTracer returns a new call tracer.
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+func (t *CallTracer) CaptureStart(from common.Address, to common.Address, assetAddr common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	typ := CALL
+	if create {
+		typ = CREATE
+	}
+	t.root = newCallFrame(typ, from, to, assetAddr, input, gas, value)
+	t.stack = []*CallFrame{t.root}
+	return nil
+}
+
+func (t *CallTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *CallTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnter opens a frame below the call currently executing.
+func (t *CallTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) error {
+	frame := newCallFrame(typ, from, to, assetAddr, input, gas, value)
+	if len(t.stack) > 0 {
+		parent := t.stack[len(t.stack)-1]
+		parent.Calls = append(parent.Calls, frame)
+	}
+	t.stack = append(t.stack, frame)
+	return nil
+}
+
+// CaptureExit closes the frame opened by the matching CaptureEnter.
+func (t *CallTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	if len(t.stack) <= 1 {
+		return nil
+	}
+	frame := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	frame.finish(output, gasUsed, err)
+	return nil
+}
+
+func (t *CallTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	if t.root != nil {
+		t.root.finish(output, gasUsed, err)
+	}
+	t.stack = nil
+	return nil
+}
+
+// Result returns the root of the call tree, or nil if nothing was traced.
+func (t *CallTracer) Result() *CallFrame { return t.root }
+
+func newCallFrame(typ OpCode, from common.Address, to common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) *CallFrame {
+	frame := &CallFrame{
+		Type:      typ,
+		From:      from,
+		To:        to,
+		AssetAddr: assetAddr,
+		Gas:       gas,
+		Input:     common.CopyBytes(input),
+	}
+	if value != nil {
+		frame.Value = new(big.Int).Set(value)
+	}
+	return frame
+}
+
+func (f *CallFrame) finish(output []byte, gasUsed uint64, err error) {
+	f.Output = common.CopyBytes(output)
+	f.GasUsed = gasUsed
+	if err != nil {
+		f.Error = err.Error()
+	}
+	if err == errExecutionReverted {
+		f.RevertReason = unpackRevert(output)
+	}
+}
+
+// unpackRevert returns the reason of a revert encoded as Error(string), or
+// an empty string if output doesn't hold one.
+func unpackRevert(output []byte) string {
+	if len(output) < 4+64 || !bytes.Equal(output[:4], revertSelector) {
+		return ""
+	}
+	data := output[4:]
+	offset := new(big.Int).SetBytes(data[:32])
+	// len(data) is at least 64, comparing without adding can't overflow
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data))-32 {
+		return ""
+	}
+	start := offset.Uint64() + 32
+	size := new(big.Int).SetBytes(data[offset.Uint64():start])
+	if !size.IsUint64() || size.Uint64() > uint64(len(data))-start {
+		return ""
+	}
+	return string(data[start : start+size.Uint64()])
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+)
+
+func TestCallTracer(t *testing.T) {
+	tracer := NewCallTracer()
+	evm := newTracedEVM(t, tracer)
+
+	// call the callee, then create an empty contract
+	code := []byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CALL), byte(POP))
+	code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(CREATE), byte(POP), byte(STOP))
+	evm.StateDB.SetCode(testCaller, code)
+
+	if _, _, err := evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 1000000, new(big.Int)); err != nil {
+		t.Fatal(err)
+	}
+	root := tracer.Result()
+	if root == nil || root.Type != CALL || root.To != testCaller || root.AssetAddr != evm.NativeAsset || root.GasUsed == 0 {
+		t.Fatalf("root frame mismatch: have %+v", root)
+	}
+	if len(root.Calls) != 2 {
+		t.Fatalf("nested frame count mismatch: have %d, want 2", len(root.Calls))
+	}
+	call := root.Calls[0]
+	if call.Type != CALL || call.From != testCaller || call.To != testCallee || call.Gas != 0xffff || call.GasUsed != 18 {
+		t.Errorf("call frame mismatch: have %+v", call)
+	}
+	if !bytes.Equal(call.Output, common.LeftPadBytes([]byte{0x2a}, 32)) {
+		t.Errorf("call output mismatch: have %x", call.Output)
+	}
+	if create := root.Calls[1]; create.Type != CREATE || create.From != testCaller || create.Error != "" {
+		t.Errorf("create frame mismatch: have %+v", create)
+	}
+}
+
+func TestCallTracerFailedFrames(t *testing.T) {
+	tracer := NewCallTracer()
+	evm := newTracedEVM(t, tracer)
+
+	// call and create with more value than the caller holds
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH2), 0xff, 0xff, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = append(code, byte(GAS), byte(CALL), byte(POP))
+	code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20))
+	code = append(code, evm.NativeAsset.Bytes()...)
+	code = append(code, byte(PUSH2), 0xff, 0xff, byte(CREATE), byte(POP), byte(STOP))
+	evm.StateDB.SetCode(testCaller, code)
+
+	if _, _, err := evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 1000000, new(big.Int)); err != nil {
+		t.Fatal(err)
+	}
+	root := tracer.Result()
+	if len(root.Calls) != 2 {
+		t.Fatalf("nested frame count mismatch: have %d, want 2", len(root.Calls))
+	}
+	for i, typ := range []OpCode{CALL, CREATE} {
+		if frame := root.Calls[i]; frame.Type != typ || frame.Error != ErrInsufficientBalance.Error() || frame.GasUsed != 0 {
+			t.Errorf("%v frame mismatch: have %+v", typ, frame)
+		}
+	}
+}
+
+func TestUnpackRevert(t *testing.T) {
+	output := append([]byte{}, revertSelector...)
+	output = append(output, common.LeftPadBytes([]byte{0x20}, 32)...)
+	output = append(output, common.LeftPadBytes([]byte{4}, 32)...)
+	output = append(output, common.RightPadBytes([]byte("oops"), 32)...)
+	if reason := unpackRevert(output); reason != "oops" {
+		t.Errorf("reason mismatch: have %q, want %q", reason, "oops")
+	}
+	if reason := unpackRevert(output[:40]); reason != "" {
+		t.Errorf("reason of truncated output: have %q", reason)
+	}
+	// offsets and sizes close to 2^64 must not wrap around
+	huge := common.LeftPadBytes(new(big.Int).SetUint64(math.MaxUint64).Bytes(), 32)
+	bad := append(append(append([]byte{}, output[:4]...), huge...), output[36:]...)
+	if reason := unpackRevert(bad); reason != "" {
+		t.Errorf("reason of huge offset: have %q", reason)
+	}
+	bad = append(append(append([]byte{}, output[:36]...), huge...), output[68:]...)
+	if reason := unpackRevert(bad); reason != "" {
+		t.Errorf("reason of huge size: have %q", reason)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/vm-project/common"
+)
+
+// BranchCoverage counts how often a JUMPI jumped and how often it fell
+// through.
+type BranchCoverage struct {
+	Taken    uint64 `json:"taken"`
+	NotTaken uint64 `json:"notTaken"`
+}
+
+// CodeCoverage is the coverage of a single code, keyed by instruction pc.
+// Source holds the source positions of all its instructions if the code
+// was run with a source resolver.
+type CodeCoverage struct {
+	Code     []byte
+	Executed map[uint64]uint64
+	Branches map[uint64]*BranchCoverage
+	Source   map[uint64]SourcePos
+}
+
+func newCodeCoverage(code []byte, source SourceResolver, codeHash common.Hash) *CodeCoverage {
+	cc := &CodeCoverage{
+		Code:     common.CopyBytes(code),
+		Executed: make(map[uint64]uint64),
+		Branches: make(map[uint64]*BranchCoverage),
+	}
+	if source != nil {
+		for _, pc := range codeInstructions(code) {
+			if pos, ok := source(codeHash, pc); ok {
+				if cc.Source == nil {
+					cc.Source = make(map[uint64]SourcePos)
+				}
+				cc.Source[pc] = pos
+			}
+		}
+	}
+	return cc
+}
+
+// Coverage is the coverage of every code executed, keyed by code hash. It
+// is collected by a CoverageTracer and can be merged across runs.
+type Coverage struct {
+	Codes map[common.Hash]*CodeCoverage
+}
+
+// NewCoverage returns an empty coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{Codes: make(map[common.Hash]*CodeCoverage)}
+}
+
+// Merge adds the counts of other to the coverage.
+func (c *Coverage) Merge(other *Coverage) {
+	for hash, occ := range other.Codes {
+		cc, ok := c.Codes[hash]
+		if !ok {
+			cc = &CodeCoverage{
+				Code:     occ.Code,
+				Executed: make(map[uint64]uint64),
+				Branches: make(map[uint64]*BranchCoverage),
+			}
+			c.Codes[hash] = cc
+		}
+		for pc, n := range occ.Executed {
+			cc.Executed[pc] += n
+		}
+		for pc, b := range occ.Branches {
+			if cc.Branches[pc] == nil {
+				cc.Branches[pc] = new(BranchCoverage)
+			}
+			cc.Branches[pc].Taken += b.Taken
+			cc.Branches[pc].NotTaken += b.NotTaken
+		}
+		if cc.Source == nil {
+			cc.Source = occ.Source
+		}
+	}
+}
+
+// coverageJSON is the JSON form of Coverage, code hashes and code are 0x
+// prefixed hex.
+type coverageJSON struct {
+	Codes map[string]*codeCoverageJSON `json:"codes"`
+}
+
+type codeCoverageJSON struct {
+	Code     string                     `json:"code"`
+	Executed map[uint64]uint64          `json:"executed"`
+	Branches map[uint64]*BranchCoverage `json:"branches,omitempty"`
+	Source   map[uint64]SourcePos       `json:"source,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (c *Coverage) MarshalJSON() ([]byte, error) {
+	enc := coverageJSON{Codes: make(map[string]*codeCoverageJSON, len(c.Codes))}
+	for hash, cc := range c.Codes {
+		enc.Codes[common.ToHex(hash[:])] = &codeCoverageJSON{
+			Code:     "0x" + common.Bytes2Hex(cc.Code),
+			Executed: cc.Executed,
+			Branches: cc.Branches,
+			Source:   cc.Source,
+		}
+	}
+	return json.Marshal(&enc)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (c *Coverage) UnmarshalJSON(input []byte) error {
+	var dec coverageJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	c.Codes = make(map[common.Hash]*CodeCoverage, len(dec.Codes))
+	for hash, cc := range dec.Codes {
+		code := &CodeCoverage{
+			Code:     common.FromHex(cc.Code),
+			Executed: cc.Executed,
+			Branches: cc.Branches,
+			Source:   cc.Source,
+		}
+		if code.Executed == nil {
+			code.Executed = make(map[uint64]uint64)
+		}
+		if code.Branches == nil {
+			code.Branches = make(map[uint64]*BranchCoverage)
+		}
+		c.Codes[common.HexToHash(hash)] = code
+	}
+	return nil
+}
+
+// CoverageTracer is a Tracer that records the instructions executed and
+// the directions JUMPIs went, per code hash, nested frames included.
+type CoverageTracer struct {
+	// Source optionally maps instructions to source positions, they are
+	// kept with the coverage for line reports.
+	Source SourceResolver
+
+	coverage *Coverage
+}
+
+// NewCoverageTracer returns a new coverage tracer.
+func NewCoverageTracer() *CoverageTracer {
+	return &CoverageTracer{coverage: NewCoverage()}
+}
+
+// Coverage returns the coverage collected so far.
+func (t *CoverageTracer) Coverage() *Coverage {
+	return t.coverage
+}
+
+func (t *CoverageTracer) CaptureStart(from common.Address, to common.Address, assetAddr common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState counts the instruction, steps failing before they execute
+// are not counted.
+func (t *CoverageTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err != nil {
+		return nil
+	}
+	cc, ok := t.coverage.Codes[contract.CodeHash]
+	if !ok {
+		cc = newCodeCoverage(contract.Code, t.Source, contract.CodeHash)
+		t.coverage.Codes[contract.CodeHash] = cc
+	}
+	cc.Executed[pc]++
+	if op == JUMPI && stack.len() >= 2 {
+		branch := cc.Branches[pc]
+		if branch == nil {
+			branch = new(BranchCoverage)
+			cc.Branches[pc] = branch
+		}
+		if stack.Back(1).Sign() != 0 {
+			branch.Taken++
+		} else {
+			branch.NotTaken++
+		}
+	}
+	return nil
+}
+
+func (t *CoverageTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (t *CoverageTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (t *CoverageTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+func (t *CoverageTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	return nil
+}
+
+// codeInstructions returns the pcs of the instructions of code, skipping
+// push data.
+func codeInstructions(code []byte) []uint64 {
+	var pcs []uint64
+	for pc := uint64(0); pc < uint64(len(code)); pc++ {
+		pcs = append(pcs, pc)
+		if op := OpCode(code[pc]); op.IsPush() {
+			pc += uint64(op - PUSH1 + 1)
+		}
+	}
+	return pcs
+}
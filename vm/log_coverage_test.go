@@ -0,0 +1,84 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/vm-project/common"
+)
+
+func TestCoverage(t *testing.T) {
+	// jump over the STOP and the INVALID if there is call data
+	code := []byte{byte(CALLDATASIZE), byte(PUSH1), 6, byte(JUMPI), byte(STOP), 0xfe, byte(JUMPDEST), byte(STOP)}
+	source := func(hash common.Hash, pc uint64) (SourcePos, bool) {
+		return SourcePos{File: "test.easm", Line: int(pc) + 1, Column: 1}, true
+	}
+
+	coverage := NewCoverage()
+	for _, input := range [][]byte{nil, {1}} {
+		tracer := NewCoverageTracer()
+		tracer.Source = source
+		evm := newTracedEVM(t, tracer)
+		evm.StateDB.SetCode(testCaller, code)
+		if _, _, err := evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, input, 100000, new(big.Int)); err != nil {
+			t.Fatal(err)
+		}
+		coverage.Merge(tracer.Coverage())
+	}
+
+	// merged coverage survives a round trip through its JSON form
+	blob, err := json.Marshal(coverage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(blob, []byte(`{"file":"test.easm","line":1,"column":1}`)) {
+		t.Errorf("source positions not in the source map format: %s", blob)
+	}
+	coverage = new(Coverage)
+	if err := json.Unmarshal(blob, coverage); err != nil {
+		t.Fatal(err)
+	}
+	if len(coverage.Codes) != 1 {
+		t.Fatalf("code count mismatch: have %d, want 1", len(coverage.Codes))
+	}
+	want := CoverageSummary{Instructions: 7, Executed: 6, Branches: 2, BranchesCovered: 2, Lines: 7, LinesCovered: 6}
+	if have := coverage.Summary(); have != want {
+		t.Errorf("summary mismatch: have %+v, want %+v", have, want)
+	}
+
+	var text bytes.Buffer
+	if err := coverage.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "not covered  test.easm:6\n") {
+		t.Errorf("text report misses the uncovered line:\n%s", text.String())
+	}
+	var html bytes.Buffer
+	if err := coverage.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"JUMPI", "taken 1, not taken 1", "test.easm:7:1", `class="missed"`} {
+		if !strings.Contains(html.String(), s) {
+			t.Errorf("html report misses %q", s)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/common/math"
+)
+
+// JSONLogger is a Tracer that streams every step of the execution to a
+// writer as a JSON object per line, followed by a summary line once the
+// execution ends. The output follows the EIP-3155 trace format, so it can
+// be diffed against the traces of other EVM implementations.
+type JSONLogger struct {
+	encoder *json.Encoder
+	cfg     LogConfig
+}
+
+// jsonStep is the EIP-3155 form of a single executed step.
+type jsonStep struct {
+	Pc         uint64                  `json:"pc"`
+	Op         OpCode                  `json:"op"`
+	Gas        math.HexOrDecimal64     `json:"gas"`
+	GasCost    math.HexOrDecimal64     `json:"gasCost"`
+	Memory     string                  `json:"memory,omitempty"`
+	MemorySize int                     `json:"memSize"`
+	Stack      []*math.HexOrDecimal256 `json:"stack"`
+	Depth      int                     `json:"depth"`
+	Refund     uint64                  `json:"refund"`
+	OpName     string                  `json:"opName"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+// jsonSummary is the EIP-3155 summary written at the end of the execution.
+type jsonSummary struct {
+	Output  string              `json:"output"`
+	GasUsed math.HexOrDecimal64 `json:"gasUsed"`
+	Time    time.Duration       `json:"time"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// NewJSONLogger creates a new EVM tracer that prints execution steps as JSON
+// objects into the provided stream.
+func NewJSONLogger(cfg *LogConfig, writer io.Writer) *JSONLogger {
+	l := &JSONLogger{encoder: json.NewEncoder(writer)}
+	if cfg != nil {
+		l.cfg = *cfg
+	}
+	return l
+}
+
+func (l *JSONLogger) CaptureStart(from common.Address, to common.Address, assetAddr common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState outputs a new JSON object for the step about to be executed.
+func (l *JSONLogger) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	log := jsonStep{
+		Pc:         pc,
+		Op:         op,
+		Gas:        math.HexOrDecimal64(gas),
+		GasCost:    math.HexOrDecimal64(cost),
+		MemorySize: memory.Len(),
+		Stack:      make([]*math.HexOrDecimal256, 0, stack.len()),
+		Depth:      depth,
+		Refund:     env.StateDB.GetRefund(),
+		OpName:     op.String(),
+	}
+	if !l.cfg.DisableMemory && memory.Len() > 0 {
+		log.Memory = common.ToHex(memory.Data())
+	}
+	if !l.cfg.DisableStack {
+		for _, item := range stack.Data() {
+			log.Stack = append(log.Stack, (*math.HexOrDecimal256)(new(big.Int).Set(item)))
+		}
+	}
+	if err != nil {
+		log.Error = err.Error()
+	}
+	return l.encoder.Encode(log)
+}
+
+// CaptureFault is a no-op, the failing step has already been written by
+// CaptureState and the error is reported in the summary.
+func (l *JSONLogger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (l *JSONLogger) CaptureEnter(typ OpCode, from common.Address, to common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (l *JSONLogger) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+// CaptureEnd is triggered at end of execution and writes the summary line.
+func (l *JSONLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	summary := jsonSummary{
+		Output:  "0x" + common.Bytes2Hex(output),
+		GasUsed: math.HexOrDecimal64(gasUsed),
+		Time:    t,
+	}
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	return l.encoder.Encode(summary)
+}
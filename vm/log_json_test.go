@@ -0,0 +1,71 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+)
+
+// newTracedEVM returns a test EVM that reports every step to tracer.
+func newTracedEVM(t *testing.T, tracer Tracer) *EVM {
+	evm, a, _ := newTestEVM(t)
+	return NewEVM(evm.Context, a, evm.StateDB, nil, Config{Debug: true, Tracer: tracer})
+}
+
+func TestJSONLogger(t *testing.T) {
+	var out bytes.Buffer
+	evm := newTracedEVM(t, NewJSONLogger(nil, &out))
+	ret, _, err := evm.Call(AccountRef(testCaller), testCallee, evm.NativeAsset, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	// one line per instruction of the callee plus the summary
+	if len(lines) != 7 {
+		t.Fatalf("line count mismatch: have %d, want 7", len(lines))
+	}
+	first := lines[0]
+	if first["pc"] != 0.0 || first["op"] != float64(PUSH1) || first["opName"] != "PUSH1" || first["gas"] != "0x186a0" || first["gasCost"] != "0x3" || first["depth"] != 1.0 {
+		t.Errorf("first step mismatch: have %v", first)
+	}
+	mstore := lines[2]
+	if stack, ok := mstore["stack"].([]interface{}); !ok || len(stack) != 2 || stack[0] != "0x2a" || stack[1] != "0x0" {
+		t.Errorf("MSTORE stack mismatch: have %v", mstore["stack"])
+	}
+	if ret := lines[5]; ret["opName"] != "RETURN" || ret["memSize"] != 32.0 {
+		t.Errorf("RETURN step mismatch: have %v", ret)
+	}
+	summary := lines[6]
+	if summary["output"] != "0x"+common.Bytes2Hex(ret) || summary["gasUsed"] != "0x12" {
+		t.Errorf("summary mismatch: have %v", summary)
+	}
+}
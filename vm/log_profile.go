@@ -0,0 +1,274 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/vm-project/common"
+)
+
+// ProfilePC identifies an instruction of a contract code.
+type ProfilePC struct {
+	CodeHash common.Hash
+	Pc       uint64
+}
+
+// ProfileStat totals the gas, the number of executed steps and the wall time
+// spent on an instruction or an opcode.
+type ProfileStat struct {
+	Gas   uint64
+	Steps uint64
+	Time  time.Duration
+}
+
+func (s *ProfileStat) add(o *ProfileStat) {
+	s.Gas += o.Gas
+	s.Steps += o.Steps
+	s.Time += o.Time
+}
+
+// profileSample is the total of the steps executed under one call stack.
+type profileSample struct {
+	stack []ProfilePC // outermost frame first
+	stat  ProfileStat
+}
+
+// GasProfiler is a Tracer that totals the gas, steps and time spent per
+// instruction and per opcode, nested frames included. The gas of a call
+// instruction excludes the gas forwarded to the callee, which is accounted
+// to the callee's own steps. WriteProfile writes the result as a pprof
+// profile, with the call stacks of the contracts as stack traces.
+type GasProfiler struct {
+	// Source optionally maps an instruction to a source position,
+	// instructions it can't resolve are reported by their code hash and pc.
+	Source SourceResolver
+
+	pcs     map[ProfilePC]*ProfileStat
+	ops     map[OpCode]*ProfileStat
+	codes   map[common.Hash][]byte
+	samples map[string]*profileSample
+	stack   []ProfilePC // instruction executing at each depth
+
+	last     *ProfileStat // step executing since lastTime
+	lastOp   OpCode
+	lastPC   ProfilePC
+	lastKey  string
+	lastTime time.Time
+
+	start    time.Time
+	duration time.Duration
+}
+
+// NewGasProfiler returns a new profiling tracer.
+func NewGasProfiler() *GasProfiler {
+	return &GasProfiler{
+		pcs:     make(map[ProfilePC]*ProfileStat),
+		ops:     make(map[OpCode]*ProfileStat),
+		codes:   make(map[common.Hash][]byte),
+		samples: make(map[string]*profileSample),
+	}
+}
+
+func (p *GasProfiler) CaptureStart(from common.Address, to common.Address, assetAddr common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	p.start = time.Now()
+	p.stack = p.stack[:0]
+	return nil
+}
+
+// CaptureState accounts the step about to be executed, the time until the
+// next step is accounted to it too.
+func (p *GasProfiler) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	p.flush(time.Now())
+
+	loc := ProfilePC{contract.CodeHash, pc}
+	if _, ok := p.codes[loc.CodeHash]; !ok {
+		p.codes[loc.CodeHash] = contract.Code
+	}
+	if depth-1 < len(p.stack) {
+		p.stack = p.stack[:depth-1]
+	}
+	p.stack = append(p.stack, loc)
+
+	switch {
+	case err != nil:
+		// a failing step consumes all the gas left
+		cost = gas
+	case op == CALL || op == CALLEX || op == CALLCODE || op == DELEGATECALL || op == STATICCALL:
+		if cost >= env.callGasTemp {
+			cost -= env.callGasTemp
+		}
+	}
+	key := profileStackKey(p.stack)
+	if p.samples[key] == nil {
+		p.samples[key] = &profileSample{stack: append([]ProfilePC(nil), p.stack...)}
+	}
+	p.last = &ProfileStat{Gas: cost, Steps: 1}
+	p.lastOp, p.lastPC, p.lastKey = op, loc, key
+	return nil
+}
+
+// flush accounts the step captured last, along with the time it took.
+func (p *GasProfiler) flush(now time.Time) {
+	if p.last == nil {
+		p.lastTime = now
+		return
+	}
+	p.last.Time = now.Sub(p.lastTime)
+	if p.pcs[p.lastPC] == nil {
+		p.pcs[p.lastPC] = new(ProfileStat)
+	}
+	p.pcs[p.lastPC].add(p.last)
+	if p.ops[p.lastOp] == nil {
+		p.ops[p.lastOp] = new(ProfileStat)
+	}
+	p.ops[p.lastOp].add(p.last)
+	p.samples[p.lastKey].stat.add(p.last)
+
+	p.last, p.lastTime = nil, now
+}
+
+func (p *GasProfiler) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+func (p *GasProfiler) CaptureEnter(typ OpCode, from common.Address, to common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+func (p *GasProfiler) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	return nil
+}
+
+func (p *GasProfiler) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	now := time.Now()
+	p.flush(now)
+	p.duration += now.Sub(p.start)
+	return nil
+}
+
+// PCStats returns the totals per instruction.
+func (p *GasProfiler) PCStats() map[ProfilePC]ProfileStat {
+	stats := make(map[ProfilePC]ProfileStat, len(p.pcs))
+	for pc, stat := range p.pcs {
+		stats[pc] = *stat
+	}
+	return stats
+}
+
+// OpcodeStats returns the totals per opcode.
+func (p *GasProfiler) OpcodeStats() map[OpCode]ProfileStat {
+	stats := make(map[OpCode]ProfileStat, len(p.ops))
+	for op, stat := range p.ops {
+		stats[op] = *stat
+	}
+	return stats
+}
+
+// WriteProfile writes the profile in the gzipped protobuf format read by
+// `go tool pprof`. The function of an instruction is its opcode, so the
+// default view totals the opcodes, and its line is the pc within the code
+// hash, or its source position if Source knows it, so -lines totals
+// the instructions. The disassembled instruction is the system name.
+func (p *GasProfiler) WriteProfile(w io.Writer) error {
+	b := newPprofBuilder()
+	b.sampleType("gas", "gas")
+	b.sampleType("steps", "count")
+	b.sampleType("time", "nanoseconds")
+
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ids := make(map[ProfilePC]uint64)
+	for _, key := range keys {
+		sample := p.samples[key]
+		// pprof lists the leaf frame first
+		locations := make([]uint64, 0, len(sample.stack))
+		for i := len(sample.stack) - 1; i >= 0; i-- {
+			loc := sample.stack[i]
+			id, ok := ids[loc]
+			if !ok {
+				id = uint64(len(ids) + 1)
+				ids[loc] = id
+				fn, line := p.function(loc)
+				b.location(id, loc.Pc, fn, line)
+			}
+			locations = append(locations, id)
+		}
+		b.sample(locations, []int64{int64(sample.stat.Gas), int64(sample.stat.Steps), int64(sample.stat.Time)})
+	}
+	return b.write(w, p.start.UnixNano(), int64(p.duration), "gas")
+}
+
+// function returns the pprof function and line of an instruction.
+func (p *GasProfiler) function(loc ProfilePC) (pprofFunction, int64) {
+	code := p.codes[loc.CodeHash]
+	fn := pprofFunction{
+		name:       OpCode(codeByte(code, loc.Pc)).String(),
+		systemName: disassemble(code, loc.Pc),
+		filename:   common.ToHex(loc.CodeHash[:]),
+	}
+	line := int64(loc.Pc)
+	if p.Source != nil {
+		if pos, ok := p.Source(loc.CodeHash, loc.Pc); ok {
+			fn.filename, line = pos.File, int64(pos.Line)
+		}
+	}
+	return fn, line
+}
+
+func codeByte(code []byte, pc uint64) byte {
+	if pc < uint64(len(code)) {
+		return code[pc]
+	}
+	return byte(STOP)
+}
+
+// disassemble returns the instruction at pc with its immediate data.
+func disassemble(code []byte, pc uint64) string {
+	op := OpCode(codeByte(code, pc))
+	if !op.IsPush() {
+		return op.String()
+	}
+	start := pc + 1
+	end := start + uint64(op-PUSH1) + 1
+	if start > uint64(len(code)) {
+		start = uint64(len(code))
+	}
+	if end > uint64(len(code)) {
+		end = uint64(len(code))
+	}
+	return fmt.Sprintf("%v 0x%x", op, code[start:end])
+}
+
+func profileStackKey(stack []ProfilePC) string {
+	key := make([]byte, 0, len(stack)*(common.HashLength+8))
+	for _, loc := range stack {
+		key = append(key, loc.CodeHash[:]...)
+		for i := uint(0); i < 8; i++ {
+			key = append(key, byte(loc.Pc>>(56-8*i)))
+		}
+	}
+	return string(key)
+}
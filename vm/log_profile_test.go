@@ -0,0 +1,78 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/big"
+	"testing"
+)
+
+func TestGasProfiler(t *testing.T) {
+	profiler := NewGasProfiler()
+	evm := newTracedEVM(t, profiler)
+
+	code := []byte{byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, testCallee.Bytes()...)
+	code = callReturn(append(code, byte(PUSH2), 0xff, 0xff, byte(CALL))...)
+	evm.StateDB.SetCode(testCaller, code)
+
+	_, leftOverGas, err := evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the forwarded gas is accounted to the callee steps only, so the
+	// totals add up to the gas used by the call
+	var gas, steps uint64
+	for _, stat := range profiler.OpcodeStats() {
+		gas += stat.Gas
+		steps += stat.Steps
+	}
+	if gas != 100000-leftOverGas {
+		t.Errorf("profiled gas mismatch: have %d, want %d", gas, 100000-leftOverGas)
+	}
+	if steps != 12+6 {
+		t.Errorf("step count mismatch: have %d, want %d", steps, 18)
+	}
+	callPC := ProfilePC{evm.StateDB.GetCodeHash(testCaller), uint64(len(code) - 7)}
+	if stat := profiler.PCStats()[callPC]; stat.Steps != 1 || stat.Gas < 700 || stat.Gas > 800 {
+		t.Errorf("CALL instruction mismatch: have %+v", stat)
+	}
+	if stat := profiler.OpcodeStats()[PUSH1]; stat.Steps != 11 || stat.Gas != 33 {
+		t.Errorf("PUSH1 totals mismatch: have %+v", stat)
+	}
+
+	var out bytes.Buffer
+	if err := profiler.WriteProfile(&out); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"gas", "nanoseconds", "CALL", "PUSH1 0x20"} {
+		if !bytes.Contains(raw, []byte(s)) {
+			t.Errorf("profile misses string %q", s)
+		}
+	}
+}
@@ -54,7 +54,7 @@ func memoryMStore(stack *Stack) *big.Int {
 }
 
 func memoryCreate(stack *Stack) *big.Int {
-	return calcMemSize(stack.Back(1), stack.Back(2))
+	return calcMemSize(stack.Back(2), stack.Back(3))
 }
 
 func memoryCall(stack *Stack) *big.Int {
@@ -64,6 +64,17 @@ func memoryCall(stack *Stack) *big.Int {
 	return math.BigMax(x, y)
 }
 
+func memoryCallEx(stack *Stack) *big.Int {
+	x := calcMemSize(stack.Back(6), stack.Back(7))
+	y := calcMemSize(stack.Back(4), stack.Back(5))
+
+	return math.BigMax(x, y)
+}
+
+func memoryIssueAsset(stack *Stack) *big.Int {
+	return calcMemSize(stack.Back(1), big.NewInt(32))
+}
+
 func memoryCallCode(stack *Stack) *big.Int {
 	x := calcMemSize(stack.Back(5), stack.Back(6))
 	y := calcMemSize(stack.Back(3), stack.Back(4))
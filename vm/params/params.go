@@ -16,17 +16,6 @@
 
 package params
 
-import "math/big"
-
-
-// ChainConfig is the core config which determines the blockchain settings.
-// ChainConfig is stored in the database on a per block basis.
-type ChainConfig struct {
-	ChainID *big.Int `json:"chainId"` // chainId identifies the current chain and is used for replay protection
-}
-
-var DefaultChainconfig = &ChainConfig{ChainID: big.NewInt(1)}
-
 const (
 	// TxGas Per transaction not creating a contract. NOTE: Not payable on data of calls between transactions.
 	TxGas uint64 = 21000
@@ -71,6 +60,9 @@ const (
 	CreateGas        uint64 = 32000 // Once per CREATE operation & contract-creation transaction.
 	SuicideRefundGas uint64 = 24000 // Refunded following a suicide operation.
 	MemoryGas        uint64 = 3     // Times the address of the (highest referenced byte in memory + 1). NOTE: referencing happens on read, write and in instructions such as RETURN and CALL.
+	AddAssetGas       uint64 = 20000 // Once per ADDASSET operation.
+	IssueAssetGas     uint64 = 32000 // Once per ISSUEASSET operation.
+	IssueAssetDataGas uint64 = 200   // Per byte of the ISSUEASSET asset descriptor.
 
 
 	MaxCodeSize = 24576 // Maximum bytecode to permit for a contract
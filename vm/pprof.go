@@ -0,0 +1,205 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// protobuf is a minimal encoder for the wire format of the pprof profile
+// messages, see github.com/google/pprof/proto/profile.proto.
+type protobuf struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) key(tag int, wire int) {
+	b.varint(uint64(tag)<<3 | uint64(wire))
+}
+
+func (b *protobuf) uint64(tag int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(tag, wireVarint)
+	b.varint(x)
+}
+
+func (b *protobuf) int64(tag int, x int64) {
+	b.uint64(tag, uint64(x))
+}
+
+func (b *protobuf) string(tag int, s string) {
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protobuf) packed(tag int, xs []uint64) {
+	if len(xs) == 0 {
+		return
+	}
+	var p protobuf
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.message(tag, &p)
+}
+
+func (b *protobuf) message(tag int, m *protobuf) {
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+// Field numbers of the pprof messages.
+const (
+	pbProfileSampleType        = 1
+	pbProfileSample            = 2
+	pbProfileLocation          = 4
+	pbProfileFunction          = 5
+	pbProfileStringTable       = 6
+	pbProfileTimeNanos         = 9
+	pbProfileDurationNanos     = 10
+	pbProfileDefaultSampleType = 14
+
+	pbValueTypeType = 1
+	pbValueTypeUnit = 2
+
+	pbSampleLocation = 1
+	pbSampleValue    = 2
+
+	pbLocationID      = 1
+	pbLocationAddress = 3
+	pbLocationLine    = 4
+
+	pbLineFunctionID = 1
+	pbLineLine       = 2
+
+	pbFunctionID         = 1
+	pbFunctionName       = 2
+	pbFunctionSystemName = 3
+	pbFunctionFilename   = 4
+)
+
+// pprofBuilder collects the strings, functions and locations of a profile
+// and deduplicates them.
+type pprofBuilder struct {
+	strings   []string
+	stringIDs map[string]int64
+	functions map[pprofFunction]uint64
+	body      protobuf
+}
+
+type pprofFunction struct {
+	name, systemName, filename string
+}
+
+func newPprofBuilder() *pprofBuilder {
+	return &pprofBuilder{
+		strings:   []string{""},
+		stringIDs: map[string]int64{"": 0},
+		functions: make(map[pprofFunction]uint64),
+	}
+}
+
+// str returns the index of s in the string table.
+func (b *pprofBuilder) str(s string) int64 {
+	if id, ok := b.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(b.strings))
+	b.strings = append(b.strings, s)
+	b.stringIDs[s] = id
+	return id
+}
+
+func (b *pprofBuilder) sampleType(typ, unit string) {
+	var m protobuf
+	m.int64(pbValueTypeType, b.str(typ))
+	m.int64(pbValueTypeUnit, b.str(unit))
+	b.body.message(pbProfileSampleType, &m)
+}
+
+// function returns the id of the function, adding it on first use.
+func (b *pprofBuilder) function(fn pprofFunction) uint64 {
+	if id, ok := b.functions[fn]; ok {
+		return id
+	}
+	id := uint64(len(b.functions) + 1)
+	b.functions[fn] = id
+
+	var m protobuf
+	m.uint64(pbFunctionID, id)
+	m.int64(pbFunctionName, b.str(fn.name))
+	m.int64(pbFunctionSystemName, b.str(fn.systemName))
+	m.int64(pbFunctionFilename, b.str(fn.filename))
+	b.body.message(pbProfileFunction, &m)
+	return id
+}
+
+func (b *pprofBuilder) location(id uint64, address uint64, fn pprofFunction, line int64) {
+	var l protobuf
+	l.uint64(pbLineFunctionID, b.function(fn))
+	l.int64(pbLineLine, line)
+
+	var m protobuf
+	m.uint64(pbLocationID, id)
+	m.uint64(pbLocationAddress, address)
+	m.message(pbLocationLine, &l)
+	b.body.message(pbProfileLocation, &m)
+}
+
+func (b *pprofBuilder) sample(locations []uint64, values []int64) {
+	vs := make([]uint64, len(values))
+	for i, v := range values {
+		vs[i] = uint64(v)
+	}
+	var m protobuf
+	m.packed(pbSampleLocation, locations)
+	m.packed(pbSampleValue, vs)
+	b.body.message(pbProfileSample, &m)
+}
+
+// write finishes the profile and writes it gzip compressed to w, the format
+// `go tool pprof` reads.
+func (b *pprofBuilder) write(w io.Writer, timeNanos, durationNanos int64, defaultSampleType string) error {
+	b.body.int64(pbProfileDefaultSampleType, b.str(defaultSampleType))
+	b.body.int64(pbProfileTimeNanos, timeNanos)
+	b.body.int64(pbProfileDurationNanos, durationNanos)
+	for _, s := range b.strings {
+		b.body.string(pbProfileStringTable, s)
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.body.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
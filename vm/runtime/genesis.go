@@ -0,0 +1,178 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/common/math"
+	"github.com/vm-project/dep/asset"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/types"
+)
+
+// Genesis is the prestate of a run: the block context, the accounts and the
+// assets that exist before the code is executed.
+type Genesis struct {
+	Number    math.HexOrDecimal64       `json:"number"`
+	Timestamp math.HexOrDecimal64       `json:"timestamp"`
+	Coinbase  string                    `json:"coinbase"`
+	GasLimit  math.HexOrDecimal64       `json:"gasLimit"`
+	Zip       *GenesisZip               `json:"zip"`
+	Accounts  map[string]GenesisAccount `json:"accounts"`
+	Assets    []GenesisAsset            `json:"assets"`
+}
+
+// GenesisZip is the initial supply of the native ZIP asset.
+type GenesisZip struct {
+	Total    *math.HexOrDecimal256 `json:"total"`
+	Decimals uint64                `json:"decimals"`
+}
+
+// GenesisAccount is the code, storage and nonce of a prestate account.
+type GenesisAccount struct {
+	Code    string            `json:"code"`
+	Storage map[string]string `json:"storage"`
+	Nonce   uint64            `json:"nonce"`
+}
+
+// GenesisAsset is an asset issued in the prestate. The owner is issued the
+// total supply, the balances of the holders are transferred out of it and
+// the owner keeps the remainder.
+type GenesisAsset struct {
+	Name     string                           `json:"name"`
+	Symbol   string                           `json:"symbol"`
+	Total    *math.HexOrDecimal256            `json:"total"`
+	Decimals uint64                           `json:"decimals"`
+	Owner    string                           `json:"owner"`
+	Balances map[string]*math.HexOrDecimal256 `json:"balances"`
+}
+
+// ToState writes the prestate into db and returns a StateDB opened at its
+// root, along with the addresses of the issued assets in genesis order.
+func (g *Genesis) ToState(db memdb.Database) (*statedb.StateDB, []common.Address, error) {
+	state, err := statedb.New(common.Hash{}, db)
+	if err != nil {
+		return nil, nil, err
+	}
+	ledger := asset.NewAsset(state)
+	if g.Zip != nil {
+		if err := asset.InitZip(state, toBig(g.Zip.Total), g.Zip.Decimals); err != nil {
+			return nil, nil, err
+		}
+	}
+	// Accounts go in sorted order, so equal files give equal roots.
+	keys := make([]string, 0, len(g.Accounts))
+	for key := range g.Accounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		addr, account := common.HexToAddress(key), g.Accounts[key]
+		state.CreateAccount(addr)
+		if account.Code != "" {
+			state.SetCode(addr, common.FromHex(account.Code))
+		}
+		for k, v := range account.Storage {
+			state.SetState(addr, common.HexToHash(k), common.HexToHash(v))
+		}
+		if err := ledger.SetNonce(addr, account.Nonce); err != nil {
+			return nil, nil, err
+		}
+	}
+	assets := make([]common.Address, 0, len(g.Assets))
+	for _, a := range g.Assets {
+		assetAddr, err := a.issue(ledger)
+		if err != nil {
+			return nil, nil, fmt.Errorf("asset %s: %v", a.Symbol, err)
+		}
+		assets = append(assets, assetAddr)
+	}
+	root, err := state.Commit(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err = statedb.New(root, db)
+	return state, assets, err
+}
+
+// Configure sets the block context of cfg from the prestate, leaving the
+// fields the genesis doesn't specify untouched. A prestate issuing ZIP makes
+// it the asset the message moves.
+func (g *Genesis) Configure(cfg *Config) {
+	cfg.BlockNumber = new(big.Int).SetUint64(uint64(g.Number))
+	if g.Zip != nil {
+		cfg.AssetAddr = types.ZipAssetID
+	}
+	if g.Timestamp != 0 {
+		cfg.Time = new(big.Int).SetUint64(uint64(g.Timestamp))
+	}
+	if g.Coinbase != "" {
+		cfg.Coinbase = common.HexToAddress(g.Coinbase)
+	}
+	if g.GasLimit != 0 {
+		cfg.BlockGasLimit = uint64(g.GasLimit)
+	}
+}
+
+func (a *GenesisAsset) issue(ledger *asset.Asset) (common.Address, error) {
+	owner := common.HexToAddress(a.Owner)
+	desc, err := json.Marshal(&asset.AccountAssetInfo{
+		Name:     a.Name,
+		Symbol:   a.Symbol,
+		Total:    toBig(a.Total),
+		Decimals: a.Decimals,
+		Owner:    owner,
+	})
+	if err != nil {
+		return common.Address{}, err
+	}
+	assetAddr, err := ledger.IssueAsset(asset.AccountModel, owner, string(desc))
+	if err != nil {
+		return common.Address{}, err
+	}
+	holders := make([]string, 0, len(a.Balances))
+	for key := range a.Balances {
+		holders = append(holders, key)
+	}
+	sort.Strings(holders)
+	for _, key := range holders {
+		holder, value := common.HexToAddress(key), toBig(a.Balances[key])
+		if holder == owner {
+			continue
+		}
+		if err := ledger.SubBalance(owner, assetAddr, value); err != nil {
+			return common.Address{}, err
+		}
+		if err := ledger.AddBalance(holder, assetAddr, value); err != nil {
+			return common.Address{}, err
+		}
+	}
+	return assetAddr, nil
+}
+
+func toBig(i *math.HexOrDecimal256) *big.Int {
+	if i == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set((*big.Int)(i))
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/vm-project/common"
+	"github.com/vm-project/dep/asset"
+	"github.com/vm-project/dep/memdb"
+	"github.com/vm-project/types"
+)
+
+const testGenesis = `{
+	"number": "0x10",
+	"timestamp": "1530000000",
+	"coinbase": "0x00000000000000000000000000000000000000cb",
+	"gasLimit": "8000000",
+	"zip": {"total": "1000000", "decimals": 8},
+	"accounts": {
+		"0x00000000000000000000000000000000000000aa": {
+			"code": "0x6001600055",
+			"storage": {"0x01": "0x2a"},
+			"nonce": 3
+		}
+	},
+	"assets": [{
+		"name": "test",
+		"symbol": "TST",
+		"total": "1000",
+		"decimals": 2,
+		"owner": "0x00000000000000000000000000000000000000aa",
+		"balances": {"0x00000000000000000000000000000000000000bb": "300"}
+	}]
+}`
+
+func TestGenesisToState(t *testing.T) {
+	genesis := new(Genesis)
+	if err := json.Unmarshal([]byte(testGenesis), genesis); err != nil {
+		t.Fatal(err)
+	}
+	state, assets, err := genesis.ToState(memdb.NewMemDatabase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := asset.NewAsset(state)
+	owner, holder := common.HexToAddress("0xaa"), common.HexToAddress("0xbb")
+
+	if code := common.Bytes2Hex(state.GetCode(owner)); code != "6001600055" {
+		t.Errorf("code mismatch: have %s", code)
+	}
+	if value := state.GetState(owner, common.HexToHash("0x01")); value != common.HexToHash("0x2a") {
+		t.Errorf("storage mismatch: have %x", value)
+	}
+	if nonce := ledger.GetNonce(owner); nonce != 3 {
+		t.Errorf("nonce mismatch: have %d, want 3", nonce)
+	}
+	if len(assets) != 1 {
+		t.Fatalf("issued assets mismatch: have %d, want 1", len(assets))
+	}
+	if balance := ledger.GetBalance(owner, assets[0]).(*big.Int); balance.Cmp(big.NewInt(700)) != 0 {
+		t.Errorf("owner balance mismatch: have %v, want 700", balance)
+	}
+	if balance := ledger.GetBalance(holder, assets[0]).(*big.Int); balance.Cmp(big.NewInt(300)) != 0 {
+		t.Errorf("holder balance mismatch: have %v, want 300", balance)
+	}
+	if balance := ledger.GetBalance(types.ZipAccount, types.ZipAssetID).(*big.Int); balance.Cmp(big.NewInt(1000000)) != 0 {
+		t.Errorf("zip supply mismatch: have %v, want 1000000", balance)
+	}
+
+	cfg := new(Config)
+	genesis.Configure(cfg)
+	setDefaults(cfg)
+	if cfg.BlockNumber.Uint64() != 16 || cfg.Time.Uint64() != 1530000000 || cfg.BlockGasLimit != 8000000 {
+		t.Errorf("block context mismatch: have number %v time %v gas limit %d", cfg.BlockNumber, cfg.Time, cfg.BlockGasLimit)
+	}
+	if cfg.Coinbase != common.HexToAddress("0xcb") {
+		t.Errorf("coinbase mismatch: have %x", cfg.Coinbase)
+	}
+	if cfg.AssetAddr != types.ZipAssetID {
+		t.Errorf("asset mismatch: have %x, want %x", cfg.AssetAddr, types.ZipAssetID)
+	}
+
+	// the value a call moves is taken out of the ZIP supply
+	if err := ledger.SubBalance(types.ZipAccount, types.ZipAssetID, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ledger.AddBalance(cfg.Origin, types.ZipAssetID, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	cfg.State, cfg.Value = state, big.NewInt(40)
+	if _, _, err := Call(holder, nil, cfg); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if balance := ledger.GetBalance(holder, types.ZipAssetID).(*big.Int); balance.Cmp(big.NewInt(40)) != 0 {
+		t.Errorf("zip transfer mismatch: have %v, want 40", balance)
+	}
+}
@@ -20,14 +20,15 @@ import (
 	"math"
 	"math/big"
 	"time"
-	"fmt"
 	"encoding/json"
 	"github.com/vm-project/vm/params"
 	"github.com/vm-project/vm"
 	"github.com/vm-project/common"
 	"github.com/vm-project/dep/asset"
 	"github.com/vm-project/dep/crypto"
+	"github.com/vm-project/dep/memdb"
 	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/vm/log"
 )
 
 // Config is a basic type specifying certain configuration flags for running
@@ -40,8 +41,10 @@ type Config struct {
 	BlockNumber *big.Int
 	Time        *big.Int
 	GasLimit    uint64
+	BlockGasLimit uint64
 	GasPrice    *big.Int
 	Value       *big.Int
+	AssetAddr   common.Address
 	Debug       bool
 	EVMConfig   vm.Config
 	asset       *asset.Asset
@@ -52,15 +55,7 @@ type Config struct {
 // sets defaults on the config
 func setDefaults(cfg *Config) {
 	if cfg.ChainConfig == nil {
-		//cfg.ChainConfig = &params.ChainConfig{
-		//	ChainID:        big.NewInt(1),
-		//	HomesteadBlock: new(big.Int),
-		//	DAOForkBlock:   new(big.Int),
-		//	DAOForkSupport: false,
-		//	EIP150Block:    new(big.Int),
-		//	EIP155Block:    new(big.Int),
-		//	EIP158Block:    new(big.Int),
-		//}
+		cfg.ChainConfig = params.DefaultChainconfig
 	}
 
 	if cfg.Difficulty == nil {
@@ -72,6 +67,9 @@ func setDefaults(cfg *Config) {
 	if cfg.GasLimit == 0 {
 		cfg.GasLimit = math.MaxUint64
 	}
+	if cfg.BlockGasLimit == 0 {
+		cfg.BlockGasLimit = cfg.GasLimit
+	}
 	if cfg.GasPrice == nil {
 		cfg.GasPrice = new(big.Int)
 	}
@@ -81,6 +79,9 @@ func setDefaults(cfg *Config) {
 	if cfg.BlockNumber == nil {
 		cfg.BlockNumber = new(big.Int)
 	}
+	if cfg.AssetAddr == (common.Address{}) {
+		cfg.AssetAddr = common.BytesToAddress([]byte("asset"))
+	}
 	cfg.Origin = common.BytesToAddress([]byte("sender"))
 	if cfg.GetHashFn == nil {
 		cfg.GetHashFn = func(n uint64) common.Hash {
@@ -90,10 +91,10 @@ func setDefaults(cfg *Config) {
 }
 //create a new evm env
 func NewEnv(cfg *Config) *vm.EVM {
-	fmt.Println("in NewEnv ...")
+	vmlog.DebugPrint("in NewEnv ...")
 	context := vm.Context{
 		CanTransfer: vm.CanTransfer,
-		//Transfer:    vm.Transfer,
+		Transfer:    vm.Transfer,
 		GetHash:     func(uint64) common.Hash { return common.Hash{} },
 
 		From:      cfg.Origin,
@@ -101,11 +102,15 @@ func NewEnv(cfg *Config) *vm.EVM {
 		BlockNumber: cfg.BlockNumber,
 		Time:        cfg.Time,
 		Difficulty:  cfg.Difficulty,
-		GasLimit:    cfg.GasLimit,
+		GasLimit:    cfg.BlockGasLimit,
 		GasPrice:    cfg.GasPrice,
+		NativeAsset: cfg.AssetAddr,
 	}
 
-	return vm.NewEVM(context, cfg.asset ,*cfg.State,  cfg.EVMConfig)
+	if cfg.asset == nil {
+		cfg.asset = asset.NewAsset(cfg.State)
+	}
+	return vm.NewEVM(context, cfg.asset, cfg.State, cfg.ChainConfig, cfg.EVMConfig)
 }
 
 // Execute executes the code using the input as call data during the execution.
@@ -114,7 +119,7 @@ func NewEnv(cfg *Config) *vm.EVM {
 // Executes sets up a in memory, temporarily, environment for the execution of
 // the given code. It makes sure that it's restored to it's original state afterwards.
 func Execute(code []byte, input []byte, cfg *Config) ([]byte, *statedb.StateDB, error) {
-	fmt.Println("in runtime.execute ...")
+	vmlog.DebugPrint("in runtime.execute ...")
 	if cfg == nil {
 		cfg = new(Config)
 
@@ -122,7 +127,7 @@ func Execute(code []byte, input []byte, cfg *Config) ([]byte, *statedb.StateDB,
 	setDefaults(cfg)
 
 	if cfg.asset == nil {
-		cfg.State, _ = statedb.New(common.Hash{})
+		cfg.State, _ = statedb.New(common.Hash{}, memdb.NewMemDatabase())
 
 		//cfg.State, _ = state.New(parent.Root(), state.NewDatabase())
 		//cfg.EvmDB =
@@ -136,12 +141,10 @@ func Execute(code []byte, input []byte, cfg *Config) ([]byte, *statedb.StateDB,
 	//	//cfg.EvmDB =
 	//	cfg.EvmDB = asset.NewAsset(cfg.State)
 	//}
-	fmt.Println("in runtime.execute 2...")
+	vmlog.DebugPrint("in runtime.execute 2...")
 	var (
 		ToAddress = common.BytesToAddress([]byte("contractTest"))
-		vmenv   = NewEnv(cfg)
 		//sender  = vm.AccountRef(cfg.Origin)
-		//assetAddr = common.BytesToAddress([]byte("asset"))
 		//assetAddr = types.ZipAssetID
 	)
 	//fmt.Println("in runtime.execute 31...")
@@ -156,25 +159,28 @@ func Execute(code []byte, input []byte, cfg *Config) ([]byte, *statedb.StateDB,
 
 	b, err := json.Marshal(info)
 	if err != nil {
-		fmt.Println("Unexpected error : %v", err)
+		vmlog.ErrorPrint("Unexpected error : %v", err)
 	}
     //注册并发行
 	assetAddress, err := cfg.asset.IssueAsset(asset.AccountModel, account1, string(b))
 	if err != nil {
-		fmt.Println("Unexpected error : %v", err)
+		vmlog.ErrorPrint("Unexpected error : %v", err)
 	}
 	//增发20
 	err = cfg.asset.IncreaseAsset(cfg.Origin , assetAddress, big.NewInt(20))
 	if err != nil {
-		fmt.Println("Unexpected error : %v", err)
+		vmlog.ErrorPrint("Unexpected error : %v", err)
 	}
 
 	v := cfg.asset.GetBalance(cfg.Origin , assetAddress)
 	value := v.(*big.Int)
 	if value.Cmp(big.NewInt(2120)) != 0 {
-		fmt.Println("Unexpected error : %v", err)
+		vmlog.ErrorPrint("Unexpected error : %v", err)
 	}
-	fmt.Println("asset value=",value)
+	vmlog.DebugPrint("asset value=%v", value)
+	// the freshly issued asset is the one plain CALLs move around
+	cfg.AssetAddr = assetAddress
+	vmenv := NewEnv(cfg)
 	// set the receiver's (the executing contract) code for execution.
 	cfg.State.SetCode(ToAddress, code)
 	// Call the code with the given configuration.
@@ -186,7 +192,8 @@ func Execute(code []byte, input []byte, cfg *Config) ([]byte, *statedb.StateDB,
 		cfg.GasLimit,
 		cfg.Value,
 	)
-	fmt.Println("out runtime.execute ...")
+	cfg.State.Finalise(true)
+	vmlog.DebugPrint("out runtime.execute ...")
 	return ret, cfg.State, err
 }
 
@@ -198,22 +205,22 @@ func Create(input []byte, cfg *Config) ([]byte, common.Address, uint64, error) {
 	setDefaults(cfg)
 
 	if cfg.State == nil {
-		cfg.State, _ = statedb.New(common.Hash{})
+		cfg.State, _ = statedb.New(common.Hash{}, memdb.NewMemDatabase())
 	}
 	var (
 		vmenv  = NewEnv(cfg)
 		sender = vm.AccountRef(cfg.Origin)
-		assetAddr = common.BytesToAddress([]byte("asset"))
 	)
 
 	// Call the code with the given configuration.
 	code, address, leftOverGas, err := vmenv.Create(
 		sender,
-		assetAddr,
+		cfg.AssetAddr,
 		input,
 		cfg.GasLimit,
 		cfg.Value,
 	)
+	cfg.State.Finalise(true)
 	return code, address, leftOverGas, err
 }
 
@@ -226,17 +233,17 @@ func Call(address common.Address, input []byte, cfg *Config) ([]byte, uint64, er
 	setDefaults(cfg)
 
 	vmenv := NewEnv(cfg)
-	var assetAddr = common.BytesToAddress([]byte("asset"))
 	sender := cfg.State.GetOrNewStateObject(cfg.Origin)
 	// Call the code with the given configuration.
 	ret, leftOverGas, err := vmenv.Call(
 		sender,
 		address,
-		assetAddr,
+		cfg.AssetAddr,
 		input,
 		cfg.GasLimit,
 		cfg.Value,
 	)
+	cfg.State.Finalise(true)
 
 	return ret, leftOverGas, err
 }
@@ -0,0 +1,56 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+
+	"github.com/vm-project/common"
+)
+
+// SourcePos is the position in a source file an instruction was compiled
+// from.
+type SourcePos struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`   // 1-based
+	Column int    `json:"column"` // 1-based
+}
+
+func (p SourcePos) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// SourceResolver returns the source position of the instruction at pc of
+// the code with the given hash, ok is false for code or instructions it
+// has no source for.
+type SourceResolver func(codeHash common.Hash, pc uint64) (pos SourcePos, ok bool)
+
+// SourceError is an execution error located in the source of the code that
+// failed. The interpreter only returns it if Config.Source is set.
+type SourceError struct {
+	Pos SourcePos
+	Err error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Err)
+}
+
+// Unwrap returns the execution error.
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
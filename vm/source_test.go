@@ -0,0 +1,60 @@
+// Copyright 2018 The zipper team Authors
+// This file is part of the z0 library.
+//
+// The z0 library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The z0 library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the z0 library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/vm-project/common"
+)
+
+func TestSourceError(t *testing.T) {
+	base, a, _ := newTestEVM(t)
+	code := []byte{byte(PUSH1), 0x10, byte(JUMP)}
+	base.StateDB.SetCode(testCaller, code)
+	codeHash := base.StateDB.GetCodeHash(testCaller)
+
+	source := func(hash common.Hash, pc uint64) (SourcePos, bool) {
+		if hash != codeHash {
+			return SourcePos{}, false
+		}
+		return SourcePos{File: "test.easm", Line: int(pc) + 1, Column: 1}, true
+	}
+	logger := NewStructLogger(nil)
+	evm := NewEVM(base.Context, a, base.StateDB, nil, Config{Debug: true, Tracer: logger, Source: source})
+
+	_, _, err := evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 100000, new(big.Int))
+	serr, ok := err.(*SourceError)
+	if !ok {
+		t.Fatalf("expected a source error, have %v", err)
+	}
+	if serr.Pos.Line != 3 || !strings.HasPrefix(serr.Error(), "test.easm:3:1: invalid jump destination") {
+		t.Errorf("error mismatch: have %v", serr)
+	}
+	logs := logger.StructLogs()
+	if len(logs) != 2 || logs[1].Source == nil || *logs[1].Source != serr.Pos {
+		t.Errorf("trace source mismatch: have %+v", logs)
+	}
+	// the wrapped error stays matchable
+	_, _, err = evm.Call(AccountRef(testCaller), testCaller, evm.NativeAsset, nil, 2, new(big.Int))
+	if _, ok := err.(*SourceError); !ok || !errors.Is(err, ErrOutOfGas) {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrOutOfGas)
+	}
+}
@@ -21,12 +21,13 @@ import (
 	"math/big"
 	"sync/atomic"
 	"time"
-	"fmt"
 	"github.com/vm-project/vm/params"
 	"github.com/vm-project/common"
 	"github.com/vm-project/dep/statedb"
+	"github.com/vm-project/vm/log"
 	"github.com/vm-project/dep/asset"
 	"github.com/vm-project/dep/crypto"
+	"github.com/vm-project/types"
 )
 
 
@@ -52,6 +53,11 @@ type Context struct {
 	From   common.Address // Provides information for ORIGIN
 	GasPrice *big.Int       // Provides information for GASPRICE
 
+	// NativeAsset is the asset moved by the value argument of CALL and
+	// CALLCODE, which carry no asset id of their own, and read by BALANCE for
+	// a zero asset id. It defaults to types.ZipAssetID.
+	NativeAsset common.Address
+
 	// Block information
 	Coinbase    common.Address // Provides information for COINBASE
 	GasLimit    uint64         // Provides information for GASLIMIT
@@ -70,14 +76,14 @@ type EVM struct {
 	//EvmDB EvmDB
 	// StateDB gives access to the underlying state
 
-	StateDB statedb.StateDB
+	StateDB *statedb.StateDB
 	// Depth is the current call stack
 	depth int
 
 	// chainConfig contains information about the current chain
 	chainConfig *params.ChainConfig
 	// chain rules contains the chain rules for the current epoch
-	//chainRules params.Rules
+	chainRules params.Rules
 	// virtual machine configuration options used to initialise the
 	// evm.
 	vmConfig Config
@@ -94,14 +100,22 @@ type EVM struct {
 }
 
 // NewEVM retutrns a new EVM . The returned EVM is not thread safe and should
-// only ever be used *once*.
-func NewEVM(ctx Context, asset *asset.Asset, statedb statedb.StateDB, vmConfig Config) *EVM {
+// only ever be used *once*. A nil chainConfig selects params.DefaultChainconfig.
+func NewEVM(ctx Context, asset *asset.Asset, statedb *statedb.StateDB, chainConfig *params.ChainConfig, vmConfig Config) *EVM {
 	//fmt.Println("in NewEvm ...")
+	if ctx.NativeAsset == (common.Address{}) {
+		ctx.NativeAsset = types.ZipAssetID
+	}
+	if chainConfig == nil {
+		chainConfig = params.DefaultChainconfig
+	}
 	evm := &EVM{
 		Context:     ctx,
 		Asset:       *asset,
 		StateDB:    statedb,
 		vmConfig:    vmConfig,
+		chainConfig: chainConfig,
+		chainRules:  chainConfig.Rules(ctx.BlockNumber),
 
 	}
 
@@ -117,7 +131,7 @@ type (
 	//CanTransferFunc func(EvmDB, common.Address, *big.Int) bool
 	CanTransferFunc func(asset.Asset, common.Address, common.Address, *big.Int) bool
 	//TransferFunc    func(EvmDB, common.Address, common.Address, *big.Int)
-	TransferFunc    func(asset.Asset, common.Address, common.Address,common.Address,*big.Int)
+	TransferFunc    func(asset.Asset, common.Address, common.Address,common.Address,*big.Int) error
 	//check Asset can operate
 	CanAssetOperFunc func(asset.Asset, common.Address, common.Address,common.Address,*big.Int)
 	//AssetOper  include asset add,asset transfer,asset suicide
@@ -129,19 +143,48 @@ type (
 
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
 func run(evm *EVM, contract *Contract, input []byte) ([]byte, error) {
-	//if contract.CodeAddr != nil {
-	//	precompiles := PrecompiledContractsHomestead
-	//	if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-	//		precompiles = PrecompiledContractsByzantium
-	//	}
-	//	if p := precompiles[*contract.CodeAddr]; p != nil {
-	//		return RunPrecompiledContract(p, input, contract)
-	//	}
-	//}
+	if contract.CodeAddr != nil {
+		if p := evm.precompiles()[*contract.CodeAddr]; p != nil {
+			return RunPrecompiledContract(p, input, contract)
+		}
+	}
 	return evm.interpreter.Run(contract, input)
 }
 
+// precompiles returns the set of precompiled contracts active under the
+// current chain rules.
+func (evm *EVM) precompiles() map[common.Address]PrecompiledContract {
+	if evm.chainRules.IsByzantium {
+		return PrecompiledContractsByzantium
+	}
+	return PrecompiledContractsHomestead
+}
 
+// addInternalTx records an asset movement made by contract code. The moves
+// of the outermost call are the transaction itself and are not recorded.
+func (evm *EVM) addInternalTx(op OpCode, from, to, assetAddr common.Address, amount *big.Int, mint bool) {
+	if evm.depth == 0 || amount == nil || amount.Sign() == 0 {
+		return
+	}
+	evm.StateDB.AddInternalTx(&types.InternalTx{
+		AssetAddr: assetAddr,
+		From:      from,
+		To:        to,
+		Amount:    new(big.Int).Set(amount),
+		Depth:     evm.depth,
+		Op:        op.String(),
+		Mint:      mint,
+	})
+}
+
+// captureFailedEnter reports a nested frame that failed before it ran to the
+// tracer, so it still shows up in the call tree.
+func (evm *EVM) captureFailedEnter(typ OpCode, from, to, assetAddr common.Address, input []byte, gas uint64, value *big.Int, err error) {
+	if evm.vmConfig.Debug && evm.depth > 0 {
+		evm.vmConfig.Tracer.CaptureEnter(typ, from, to, assetAddr, input, gas, value)
+		evm.vmConfig.Tracer.CaptureExit(nil, 0, err)
+	}
+}
 
 // Cancel cancels any running EVM operation. This may be called concurrently and
 // it's safe to be called multiple times.
@@ -154,17 +197,29 @@ func (evm *EVM) Cancel() {
 // the necessary steps to create accounts and reverses the state in case of an
 // execution error or failed value transfer.
 func (evm *EVM) Call(caller ContractRef, addr common.Address, assetAddr common.Address,input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
-	fmt.Println("in evm.call ...")
+	return evm.call(CALL, caller, addr, assetAddr, input, gas, value)
+}
+
+// CallEx is Call on behalf of the CALLEX opcode, which names the transferred
+// asset explicitly. It only differs from Call in how the frame is traced.
+func (evm *EVM) CallEx(caller ContractRef, addr common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	return evm.call(CALLEX, caller, addr, assetAddr, input, gas, value)
+}
+
+func (evm *EVM) call(typ OpCode, caller ContractRef, addr common.Address, assetAddr common.Address, input []byte, gas uint64, value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+	vmlog.DebugPrint("in evm.call ...")
 	if evm.vmConfig.NoRecursion && evm.depth > 0 {
 		return nil, gas, nil
 	}
 	//fmt.Println("in evm.call 0 ...")
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
+		evm.captureFailedEnter(typ, caller.Address(), addr, assetAddr, input, gas, value, ErrDepth)
 		return nil, gas, ErrDepth
 	}
 	// Fail if we're trying to transfer more than the available balance
 	if !CanTransfer(evm.Asset, caller.Address(),assetAddr, value) {
+		evm.captureFailedEnter(typ, caller.Address(), addr, assetAddr, input, gas, value, ErrInsufficientBalance)
 		return nil, gas, ErrInsufficientBalance
 	}
 	//fmt.Println("in evm.call 1 ...")
@@ -173,19 +228,29 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, assetAddr common.A
 		snapshot = evm.StateDB.Snapshot()
 	)
 	if !evm.StateDB.Exist(addr) {
-		//precompiles := PrecompiledContractsHomestead
-		//if evm.ChainConfig().IsByzantium(evm.BlockNumber) {
-		//	precompiles = PrecompiledContractsByzantium
-		//}
-		//if precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
-		//	return nil, gas, nil
-		//}
-		fmt.Println("create account ...")
+		if evm.precompiles()[addr] == nil && evm.chainRules.IsEIP158 && (value == nil || value.Sign() == 0) {
+			// Calling a non existing account, don't do anything, but keep
+			// it in the trace
+			if evm.vmConfig.Debug && evm.depth == 0 {
+				evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, assetAddr, false, input, gas, value)
+				evm.vmConfig.Tracer.CaptureEnd(ret, 0, 0, nil)
+			} else if evm.vmConfig.Debug {
+				evm.vmConfig.Tracer.CaptureEnter(typ, caller.Address(), addr, assetAddr, input, gas, value)
+				evm.vmConfig.Tracer.CaptureExit(ret, 0, nil)
+			}
+			return nil, gas, nil
+		}
+		vmlog.DebugPrint("create account ...")
 		evm.StateDB.CreateAccount(addr)
 	}
 	//
-	fmt.Println("evm.Transfer ...")
-	evm.Transfer(evm.Asset, caller.Address(), to.Address(), assetAddr,value)
+	vmlog.DebugPrint("evm.Transfer ...")
+	if err = evm.Transfer(evm.Asset, caller.Address(), to.Address(), assetAddr, value); err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.captureFailedEnter(typ, caller.Address(), addr, assetAddr, input, gas, value, err)
+		return nil, gas, err
+	}
+	evm.addInternalTx(typ, caller.Address(), to.Address(), assetAddr, value, false)
 
 	// Initialise a new contract and set the code that is to be used by the EVM.
 	// The contract is a scoped environment for this execution context only.
@@ -196,13 +261,20 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, assetAddr common.A
 
 	// Capture the tracer start/end events in debug mode
 	if evm.vmConfig.Debug && evm.depth == 0 {
-		evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
+		evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, assetAddr, false, input, gas, value)
 
 		defer func() { // Lazy evaluation of the parameters
 			evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
 		}()
 	}
-	fmt.Println("before run ...")
+	if evm.vmConfig.Debug && evm.depth > 0 {
+		evm.vmConfig.Tracer.CaptureEnter(typ, caller.Address(), addr, assetAddr, input, gas, value)
+
+		defer func() {
+			evm.vmConfig.Tracer.CaptureExit(ret, gas-contract.Gas, err)
+		}()
+	}
+	vmlog.DebugPrint("before run ...")
 	ret, err = run(evm, contract, input)
 
 	// When an error was returned by the EVM or when setting the creation code
@@ -214,7 +286,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, assetAddr common.A
 			contract.UseGas(contract.Gas)
 		}
 	}
-	fmt.Println("out evm.call ...")
+	vmlog.DebugPrint("out evm.call ...")
 	return ret, contract.Gas, err
 }
 
@@ -232,10 +304,12 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, assetAddr comm
 
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
+		evm.captureFailedEnter(CALLCODE, caller.Address(), addr, assetAddr, input, gas, value, ErrDepth)
 		return nil, gas, ErrDepth
 	}
 	// Fail if we're trying to transfer more than the available balance
 	if !evm.CanTransfer(evm.Asset, caller.Address(), assetAddr,value) {
+		evm.captureFailedEnter(CALLCODE, caller.Address(), addr, assetAddr, input, gas, value, ErrInsufficientBalance)
 		return nil, gas, ErrInsufficientBalance
 	}
 
@@ -249,6 +323,13 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, assetAddr comm
 	contract := NewContract(caller, to, value, gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if evm.vmConfig.Debug && evm.depth > 0 {
+		evm.vmConfig.Tracer.CaptureEnter(CALLCODE, caller.Address(), addr, assetAddr, input, gas, value)
+
+		defer func() {
+			evm.vmConfig.Tracer.CaptureExit(ret, gas-contract.Gas, err)
+		}()
+	}
 	ret, err = run(evm, contract, input)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
@@ -270,6 +351,7 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	}
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
+		evm.captureFailedEnter(DELEGATECALL, caller.Address(), addr, common.Address{}, input, gas, nil, ErrDepth)
 		return nil, gas, ErrDepth
 	}
 
@@ -282,6 +364,13 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	contract := NewContract(caller, to, nil, gas).AsDelegate()
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if evm.vmConfig.Debug && evm.depth > 0 {
+		evm.vmConfig.Tracer.CaptureEnter(DELEGATECALL, caller.Address(), addr, common.Address{}, input, gas, nil)
+
+		defer func() {
+			evm.vmConfig.Tracer.CaptureExit(ret, gas-contract.Gas, err)
+		}()
+	}
 	ret, err = run(evm, contract, input)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
@@ -302,6 +391,7 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	}
 	// Fail if we're trying to execute above the call depth limit
 	if evm.depth > int(params.CallCreateDepth) {
+		evm.captureFailedEnter(STATICCALL, caller.Address(), addr, common.Address{}, input, gas, nil, ErrDepth)
 		return nil, gas, ErrDepth
 	}
 	// Make sure the readonly is only set if we aren't in readonly yet
@@ -322,6 +412,13 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	contract := NewContract(caller, to, new(big.Int), gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if evm.vmConfig.Debug && evm.depth > 0 {
+		evm.vmConfig.Tracer.CaptureEnter(STATICCALL, caller.Address(), addr, common.Address{}, input, gas, nil)
+
+		defer func() {
+			evm.vmConfig.Tracer.CaptureExit(ret, gas-contract.Gas, err)
+		}()
+	}
 	// When an error was returned by the EVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
 	// when we're in Homestead this also counts for code storage gas errors.
@@ -341,9 +438,11 @@ func (evm *EVM) Create(caller ContractRef, assetAddr common.Address,code []byte,
 	// Depth check execution. Fail if we're trying to execute above the
 	// limit.
 	if evm.depth > int(params.CallCreateDepth) {
+		evm.captureFailedEnter(CREATE, caller.Address(), common.Address{}, assetAddr, code, gas, value, ErrDepth)
 		return nil, common.Address{}, gas, ErrDepth
 	}
 	if !evm.CanTransfer(evm.Asset, caller.Address(), assetAddr,value) {
+		evm.captureFailedEnter(CREATE, caller.Address(), common.Address{}, assetAddr, code, gas, value, ErrInsufficientBalance)
 		return nil, common.Address{}, gas, ErrInsufficientBalance
 	}
 	// Ensure there's no existing contract already at the designated address
@@ -354,15 +453,21 @@ func (evm *EVM) Create(caller ContractRef, assetAddr common.Address,code []byte,
 	contractHash := evm.StateDB.GetCodeHash(contractAddr)
 
 	if evm.Asset.GetNonce(contractAddr) != 0 || (contractHash != (common.Hash{}) && contractHash != emptyCodeHash) {
+		evm.captureFailedEnter(CREATE, caller.Address(), contractAddr, assetAddr, code, gas, value, ErrContractAddressCollision)
 		return nil, common.Address{}, 0, ErrContractAddressCollision
 	}
 	// Create a new account on the state
 	snapshot := evm.StateDB.Snapshot()
 	evm.StateDB.CreateAccount(contractAddr)
-	//if evm.ChainConfig().IsEIP158(evm.BlockNumber) {
-	//	evm.StateDB.SetNonce(contractAddr, 1)
-	//}
-	evm.Transfer(evm.Asset, caller.Address(), contractAddr,assetAddr, value)
+	if evm.chainRules.IsEIP158 {
+		evm.Asset.SetNonce(contractAddr, 1)
+	}
+	if err = evm.Transfer(evm.Asset, caller.Address(), contractAddr, assetAddr, value); err != nil {
+		evm.StateDB.RevertToSnapshot(snapshot)
+		evm.captureFailedEnter(CREATE, caller.Address(), contractAddr, assetAddr, code, gas, value, err)
+		return nil, common.Address{}, gas, err
+	}
+	evm.addInternalTx(CREATE, caller.Address(), contractAddr, assetAddr, value, false)
 
 	// initialise a new contract and set the code that is to be used by the
 	// E The contract is a scoped evmironment for this execution context
@@ -375,15 +480,17 @@ func (evm *EVM) Create(caller ContractRef, assetAddr common.Address,code []byte,
 	}
 
 	if evm.vmConfig.Debug && evm.depth == 0 {
-		evm.vmConfig.Tracer.CaptureStart(caller.Address(), contractAddr, true, code, gas, value)
+		evm.vmConfig.Tracer.CaptureStart(caller.Address(), contractAddr, assetAddr, true, code, gas, value)
+	}
+	if evm.vmConfig.Debug && evm.depth > 0 {
+		evm.vmConfig.Tracer.CaptureEnter(CREATE, caller.Address(), contractAddr, assetAddr, code, gas, value)
 	}
 	start := time.Now()
 
 	ret, err = run(evm, contract, nil)
 
 	// check whether the max code size has been exceeded
-	//maxCodeSizeExceeded := evm.ChainConfig().IsEIP158(evm.BlockNumber) && len(ret) > params.MaxCodeSize
-	maxCodeSizeExceeded := len(ret) > params.MaxCodeSize
+	maxCodeSizeExceeded := evm.chainRules.IsEIP158 && len(ret) > params.MaxCodeSize
 	// if the contract creation ran successfully and no errors were returned
 	// calculate the gas required to store the code. If the code could not
 	// be stored due to not enough gas set an error and let it be handled
@@ -400,7 +507,7 @@ func (evm *EVM) Create(caller ContractRef, assetAddr common.Address,code []byte,
 	// When an error was returned by the EVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
 	// when we're in homestead this also counts for code storage gas errors.
-	if maxCodeSizeExceeded || (err != nil || err != ErrCodeStoreOutOfGas) {
+	if maxCodeSizeExceeded || (err != nil && (evm.chainRules.IsHomestead || err != ErrCodeStoreOutOfGas)) {
 		evm.StateDB.RevertToSnapshot(snapshot)
 		if err != errExecutionReverted {
 			contract.UseGas(contract.Gas)
@@ -413,6 +520,9 @@ func (evm *EVM) Create(caller ContractRef, assetAddr common.Address,code []byte,
 	if evm.vmConfig.Debug && evm.depth == 0 {
 		evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
 	}
+	if evm.vmConfig.Debug && evm.depth > 0 {
+		evm.vmConfig.Tracer.CaptureExit(ret, gas-contract.Gas, err)
+	}
 	return ret, contractAddr, contract.Gas, err
 }
 
@@ -425,7 +535,11 @@ func (evm *EVM) Interpreter() *Interpreter { return evm.interpreter }
 // CanTransfer checks wether there are enough funds in the address' account to make a transfer.
 // This does not take the necessary gas in to account to make the transfer valid.
 func CanTransfer(asset asset.Asset, addr common.Address, assetAddr common.Address,  amount *big.Int) bool {
-	fmt.Println("in CanTransfer ...")
+	vmlog.DebugPrint("in CanTransfer ...")
+	// Moving nothing is always allowed, even for assets the account never held.
+	if amount == nil || amount.Sign() == 0 {
+		return true
+	}
 	//value := asset.GetBalance(addr,assetAddr)
 	//fmt.Println("out GetBalance ...")
 	//return db.GetBalance(addr,assetAddr).(big.Int).Cmp(amount) >= 0
@@ -436,12 +550,26 @@ func CanTransfer(asset asset.Asset, addr common.Address, assetAddr common.Addres
 	if err != nil{
 		return false
 	}
-	fmt.Println("out CanTransfer value")
+	vmlog.DebugPrint("out CanTransfer value")
 	//return bEnough
 	//return v.Cmp(amount) >= 0
 	return bEnough
 }
 
+// Transfer subtracts amount of the given asset from sender and adds amount to
+// recipient. The ledger writes are journaled, so they are undone together with
+// the rest of the call when it reverts. On an error the caller has to revert,
+// the debit may have been applied without the credit.
+func Transfer(asset asset.Asset, sender, recipient, assetAddr common.Address, amount *big.Int) error {
+	if amount == nil || amount.Sign() == 0 {
+		return nil
+	}
+	if err := asset.SubBalance(sender, assetAddr, amount); err != nil {
+		return err
+	}
+	return asset.AddBalance(recipient, assetAddr, amount)
+}
+
 
 
 